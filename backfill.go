@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"gorm.io/gorm"
+)
+
+// how far back a relay is read the first time we connect to it, override
+// with SYNC_LOOKBACK_HOURS
+var syncLookback = time.Duration(envInt("SYNC_LOOKBACK_HOURS", 72)) * time.Hour
+
+// events per backfill page, override with BACKFILL_PAGE_SIZE
+var backfillPageSize = envInt("BACKFILL_PAGE_SIZE", 500)
+
+// how long a backfill page waits for EOSE
+var backfillTimeout = 30 * time.Second
+
+// Backfill walks a relay backward in time, one page at a time, using the
+// oldest event of each page as the until of the next.  It stops when it
+// reaches stop, saving progress after every page so that it resumes where it
+// left off.  An empty page only says there is nothing newer than stop, so a
+// later run with an earlier stop carries on from there.
+func Backfill(db *gorm.DB, ctx context.Context, url string, stop time.Time, report func(BackfillProgress)) error {
+	progress := BackfillProgress{Url: url, Until: time.Now()}
+	db.First(&progress, "url = ?", url)
+	if !progress.Until.After(stop) {
+		report(progress)
+		return nil
+	}
+
+	relay, err := dialRelay(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer closeRelay(relay, nil)
+	go func() {
+		for notice := range relay.Notices {
+			TheLog.Printf("backfill relay: %s notice: %s\n", url, notice)
+		}
+	}()
+
+	info, foundInfo := GetRelayInfo(db, ctx, url)
+	for progress.Until.After(stop) {
+		until := progress.Until
+		filters := nostr.Filters{{
+			Kinds: []int{0, 2, 3, KindRelayList},
+			Since: &stop,
+			Until: &until,
+			Limit: backfillPageSize,
+		}}
+		if foundInfo {
+			filters = applyRelayLimits(filters, info)[0]
+		}
+		events, oldest, err := backfillPage(ctx, relay, filters)
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			ingestEvent(db, ev)
+		}
+		progress.Events += int64(len(events))
+		if len(events) == 0 {
+			// nothing left between stop and until
+			progress.Until = stop
+		} else if oldest.Before(until) {
+			// the next page starts at the oldest event, so events sharing
+			// its timestamp are not skipped
+			progress.Until = oldest
+		} else {
+			// a whole page in one second, step past it
+			progress.Until = until.Add(-time.Second)
+		}
+		if err := db.Save(&progress).Error; err != nil {
+			return err
+		}
+		report(progress)
+	}
+	return nil
+}
+
+func backfillPage(ctx context.Context, relay *nostr.Relay, filters nostr.Filters) ([]*nostr.Event, time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, backfillTimeout)
+	defer cancel()
+	sub := relay.Subscribe(ctx, filters)
+	// unblock a pending event so the subscription can close
+	defer func() {
+		go func() {
+			for range sub.Events {
+			}
+		}()
+		sub.Unsub()
+	}()
+
+	var events []*nostr.Event
+	var oldest time.Time
+	for {
+		select {
+		case ev, ok := <-sub.Events:
+			if !ok {
+				return events, oldest, nil
+			}
+			events = append(events, ev)
+			if oldest.IsZero() || ev.CreatedAt.Before(oldest) {
+				oldest = ev.CreatedAt
+			}
+		case <-sub.EndOfStoredEvents:
+			return events, oldest, nil
+		case <-ctx.Done():
+			if len(events) > 0 {
+				return events, oldest, nil
+			}
+			return nil, oldest, fmt.Errorf("timed out waiting for %s", relay.URL)
+		}
+	}
+}
+
+func cmdBackfill(db *gorm.DB, args []string) int {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	to := flags.String("to", time.Now().AddDate(-1, 0, 0).Format("2006-01-02"), "walk back to this date (YYYY-MM-DD)")
+	restart := flags.Bool("restart", false, "forget saved progress and start again from now")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	stop, err := time.Parse("2006-01-02", *to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid date %q, use YYYY-MM-DD\n", *to)
+		return 2
+	}
+
+	var urls []string
+	for _, u := range flags.Args() {
+		url, err := normalizeRelayURL(u)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 2
+		}
+		urls = append(urls, url)
+	}
+	if len(urls) == 0 {
+		db.Model(&RelayStatus{}).Pluck("url", &urls)
+	}
+	if len(urls) == 0 {
+		fmt.Fprintf(os.Stderr, "no relays to backfill from, add one first\n")
+		return 1
+	}
+
+	failed := 0
+	for _, url := range urls {
+		if *restart {
+			db.Delete(&BackfillProgress{}, "url = ?", url)
+		}
+		err := Backfill(db, CTX, url, stop, func(p BackfillProgress) {
+			state := "walking"
+			if !p.Until.After(stop) {
+				state = "reached " + *to
+			}
+			fmt.Printf("%s: %d events, back to %s (%s)\n", p.Url, p.Events, p.Until.Format(time.RFC3339), state)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", url, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
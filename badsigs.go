@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// go-nostr drops events with bad signatures inside each relay's read loop
+// and only logs them.  Relays are dialed with their url as a pprof label,
+// which the read loop goroutine inherits, so the log line can be traced back
+// to the relay that sent the event.
+
+// how often the goroutine labels may be looked up, a relay flooding bad
+// signatures gets the rest counted against it without another lookup
+var badSigLookupEvery = 100 * time.Millisecond
+
+// dialRelay connects to url like nostr.RelayConnect, labeling the
+// connection's goroutines with the url
+func dialRelay(ctx context.Context, url string) (*nostr.Relay, error) {
+	var relay *nostr.Relay
+	var err error
+	pprof.Do(ctx, pprof.Labels("relay", url), func(ctx context.Context) {
+		relay, err = nostr.RelayConnect(ctx, url)
+	})
+	return relay, err
+}
+
+// badSigLog sits in front of the standard logger that go-nostr writes to
+type badSigLog struct {
+	out        io.Writer
+	mu         sync.Mutex
+	lastLookup time.Time
+	lastRelay  string
+}
+
+// send the standard logger to our log file, counting bad signatures
+func countBadSignatures() {
+	log.SetOutput(&badSigLog{out: TheLog.Writer()})
+}
+
+func (l *badSigLog) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("bad signature")) {
+		if url := l.relay(); url != "" {
+			Metrics.InvalidSig(url)
+		}
+	}
+	return l.out.Write(p)
+}
+
+// the relay label of the goroutine that is writing the log line
+func (l *badSigLog) relay() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.lastLookup) < badSigLookupEvery {
+		return l.lastRelay
+	}
+	l.lastLookup = time.Now()
+	l.lastRelay = ""
+
+	var profile bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&profile, 1); err != nil {
+		return ""
+	}
+	// only one goroutine at a time is in here, the logger holds its lock
+	for _, stack := range strings.Split(profile.String(), "\n\n") {
+		if !strings.Contains(stack, "(*badSigLog).Write") {
+			continue
+		}
+		for _, line := range strings.Split(stack, "\n") {
+			if strings.HasPrefix(line, "# labels: ") {
+				var m map[string]string
+				if json.Unmarshal([]byte(strings.TrimPrefix(line, "# labels: ")), &m) == nil {
+					l.lastRelay = m["relay"]
+				}
+			}
+		}
+	}
+	return l.lastRelay
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"runtime/pprof"
+	"testing"
+)
+
+func TestBadSignaturesCountedPerRelay(t *testing.T) {
+	TheLog = log.New(io.Discard, "", 0)
+	Metrics = NewRelayMetrics()
+	countBadSignatures()
+	defer log.SetOutput(os.Stderr)
+	badSigLookupEvery = 0
+
+	// like go-nostr's read loop, started while dialing
+	logFrom := func(url string) {
+		done := make(chan struct{})
+		pprof.Do(context.Background(), pprof.Labels("relay", url), func(context.Context) {
+			go func() {
+				log.Printf("bad signature: ")
+				close(done)
+			}()
+		})
+		<-done
+	}
+	logFrom("wss://a.example.com")
+	logFrom("wss://a.example.com")
+	logFrom("wss://b.example.com")
+	log.Printf("something else")
+
+	Metrics.mu.Lock()
+	defer Metrics.mu.Unlock()
+	for url, want := range map[string]int{"wss://a.example.com": 2, "wss://b.example.com": 1} {
+		if c, found := Metrics.counters[url]; !found || c.invalidSigs != want {
+			t.Errorf("%s: got %+v, want %d invalid signatures", url, c, want)
+		}
+	}
+	if len(Metrics.counters) != 2 {
+		t.Errorf("counted for %d relays", len(Metrics.counters))
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import "sync"
+
+// topics on the event bus
+type Topic string
+
+const (
+	TopicRelayCommand Topic = "relay-command" // the UI asking the relay manager to do something
+	TopicRelayStatus  Topic = "relay-status"  // a relay's status changed
+	TopicProfile      Topic = "profile"       // a kind 0, 3 or 10002 was ingested
+	TopicOutbox       Topic = "outbox"        // the outbox queue changed
+	TopicAccount      Topic = "account"       // the active account changed
+	TopicRefetch      Topic = "refetch"       // a refetch of Pubkey got events, an answer or finished
+)
+
+type RelayCommand string
+
+const (
+	RelayAdd       RelayCommand = "add"
+	RelayRemove    RelayCommand = "remove"
+	RelayReconnect RelayCommand = "reconnect"
+)
+
+type BusMessage struct {
+	Topic   Topic
+	Command RelayCommand
+	Url     string
+	Pubkey  string
+	Kind    int
+}
+
+// EventBus is a small in process pub/sub.  Handlers run in the publisher's
+// goroutine, so they must not block; hand off to g.Update or a channel.
+type EventBus struct {
+	mu       sync.Mutex
+	handlers map[Topic][]func(BusMessage)
+}
+
+var Bus = NewEventBus()
+
+func NewEventBus() *EventBus {
+	return &EventBus{handlers: make(map[Topic][]func(BusMessage))}
+}
+
+func (b *EventBus) Subscribe(topic Topic, fn func(BusMessage)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[topic] = append(b.handlers[topic], fn)
+}
+
+func (b *EventBus) Publish(msg BusMessage) {
+	b.mu.Lock()
+	handlers := b.handlers[msg.Topic]
+	b.mu.Unlock()
+	for _, fn := range handlers {
+		fn(msg)
+	}
+}
+
+// ask the relay manager to add, remove or reconnect a relay
+func SendRelayCommand(cmd RelayCommand, url string) {
+	Bus.Publish(BusMessage{Topic: TopicRelayCommand, Command: cmd, Url: url})
+}
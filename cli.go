@@ -0,0 +1,499 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"gorm.io/gorm"
+)
+
+// exit status of a command that ran fine but found nothing
+const exitNotFound = 3
+
+// a profile as printed by follows list and search
+type profileRow struct {
+	Pubkey string `json:"pubkey"`
+	Npub   string `json:"npub"`
+	Name   string `json:"name"`
+	Nip05  string `json:"nip05,omitempty"`
+}
+
+func profileRows(metas []Metadata) []profileRow {
+	rows := []profileRow{}
+	for _, m := range metas {
+		npub := m.PubkeyNpub
+		if npub == "" {
+			npub, _ = nip19.EncodePublicKey(m.PubkeyHex)
+		}
+		rows = append(rows, profileRow{Pubkey: m.PubkeyHex, Npub: npub, Name: m.Name, Nip05: m.Nip05})
+	}
+	return rows
+}
+
+func printProfiles(rows []profileRow, asJSON bool) {
+	if asJSON {
+		printJSON(rows)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "NAME\tNIP05\tNPUB\n")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.Nip05, r.Npub)
+	}
+	w.Flush()
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// parse npub or hex pubkey arguments
+func parsePubkeyArgs(args []string) ([]string, error) {
+	var pubkeys []string
+	for _, a := range args {
+		pk, err := ParsePubkey(a)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", a, err)
+		}
+		pubkeys = append(pubkeys, pk)
+	}
+	return pubkeys, nil
+}
+
+// unlock the keys for a command that signs
+func unlockKeys(db *gorm.DB) error {
+	pwd, err := GetPwd()
+	if err != nil {
+		return err
+	}
+	if err := CheckPassword(db, pwd); err != nil {
+		return err
+	}
+	Password = pwd
+	if err := Keys.Unlock(db, pwd); err != nil {
+		TheLog.Printf("some keys could not be decrypted: %s\n", err)
+	}
+	return nil
+}
+
+// UseAccount makes pubkey's account the active one
+func UseAccount(db *gorm.DB, pubkey string) error {
+	var account Account
+	if err := db.First(&account, "pubkey = ?", pubkey).Error; err != nil {
+		return errors.New("no such account")
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Account{}).Where("pubkey != ?", pubkey).Update("active", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Account{}).Where("pubkey = ?", pubkey).Update("active", true).Error
+	})
+	if err != nil {
+		return err
+	}
+	Bus.Publish(BusMessage{Topic: TopicAccount})
+	return nil
+}
+
+func cmdFollows(db *gorm.DB, args []string) int {
+	if len(args) == 0 || args[0] != "list" {
+		fmt.Fprintf(os.Stderr, "usage: flightless follows list [--account npub] [--json]\n")
+		return 2
+	}
+	flags := flag.NewFlagSet("follows list", flag.ContinueOnError)
+	npub := flags.String("account", "", "npub of the account, defaults to the active one")
+	asJSON := flags.Bool("json", false, "print json")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	account, err := commandAccount(db, *npub)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	var follows []Metadata
+	db.Model(&Metadata{PubkeyHex: account.Pubkey}).Order("name").Association("Follows").Find(&follows)
+	printProfiles(profileRows(follows), *asJSON)
+	if len(follows) == 0 {
+		return exitNotFound
+	}
+	return 0
+}
+
+// follow and unfollow publish a new contact list, which replaces the old
+// one on the relays
+func cmdFollow(db *gorm.DB, args []string, unfollow bool) int {
+	name := "follow"
+	if unfollow {
+		name = "unfollow"
+	}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	npub := flags.String("account", "", "npub of the account, defaults to the active one")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: flightless %s [--account npub] <npub>...\n", name)
+		return 2
+	}
+	pubkeys, err := parsePubkeyArgs(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+	account, err := commandAccount(db, *npub)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	if account.WatchOnly {
+		fmt.Fprintf(os.Stderr, "%s is watch-only, use 'flightless unsigned contacts' to sign it elsewhere\n", account.PubkeyNpub)
+		return 1
+	}
+	// without the current list we would publish one that drops every follow
+	var me Metadata
+	if db.First(&me, "pubkey_hex = ?", account.Pubkey).Error != nil || me.ContactsUpdatedAt.IsZero() {
+		fmt.Fprintf(os.Stderr, "no contact list known for %s yet, run 'flightless sync --once' first\n", account.PubkeyNpub)
+		return 1
+	}
+
+	var ev nostr.Event
+	if unfollow {
+		ev = ContactListEvent(db, account.Pubkey, nil)
+		drop := make(map[string]bool)
+		for _, pk := range pubkeys {
+			drop[pk] = true
+		}
+		var kept nostr.Tags
+		for _, tag := range ev.Tags {
+			if !drop[tag[1]] {
+				kept = append(kept, tag)
+			}
+		}
+		if len(kept) == len(ev.Tags) {
+			fmt.Println("not following any of them, nothing to publish")
+			return 0
+		}
+		ev.Tags = kept
+	} else {
+		before := len(ContactListEvent(db, account.Pubkey, nil).Tags)
+		ev = ContactListEvent(db, account.Pubkey, pubkeys)
+		if len(ev.Tags) == before {
+			fmt.Println("already following all of them, nothing to publish")
+			return 0
+		}
+	}
+
+	if err := unlockKeys(db); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	if err := Keys.Sign(account.Pubkey, &ev); err != nil {
+		fmt.Fprintf(os.Stderr, "could not sign contact list: %s\n", err)
+		return 1
+	}
+	startHeadlessPool(db)
+	ingestEvent(db, &ev)
+	QueueEvent(db, ev, offlineDescription(ev))
+	fmt.Printf("publishing %s %s...\n", offlineDescription(ev), ev.ID)
+	if !waitForOutbox(db, ev.ID, headlessPublishWait) {
+		fmt.Fprintf(os.Stderr, "not yet accepted by %d relays, it stays in the outbox and is retried on the next start\n", outboxMinAccepts)
+		return 1
+	}
+	fmt.Println("published")
+	return 0
+}
+
+type relayRow struct {
+	Url       string    `json:"url"`
+	Status    string    `json:"status"`
+	Retries   int       `json:"retries"`
+	AllowAuth bool      `json:"allow_auth"`
+	LastEOSE  time.Time `json:"last_eose"`
+}
+
+func cmdRelays(db *gorm.DB, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: flightless relays ls [--json] | add <url>... | rm <url>...\n")
+		return 2
+	}
+	switch args[0] {
+	case "ls":
+		flags := flag.NewFlagSet("relays ls", flag.ContinueOnError)
+		asJSON := flags.Bool("json", false, "print json")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+		var statuses []RelayStatus
+		db.Order("url").Find(&statuses)
+		rows := []relayRow{}
+		for _, rs := range statuses {
+			rows = append(rows, relayRow{Url: rs.Url, Status: rs.Status, Retries: rs.Retries, AllowAuth: rs.AllowAuth, LastEOSE: rs.LastEOSE})
+		}
+		if *asJSON {
+			printJSON(rows)
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "URL\tSTATUS\tRETRIES\tAUTH\tLAST EOSE\n")
+			for _, r := range rows {
+				eose := "never"
+				if !r.LastEOSE.IsZero() {
+					eose = r.LastEOSE.Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%t\t%s\n", r.Url, r.Status, r.Retries, r.AllowAuth, eose)
+			}
+			w.Flush()
+		}
+		if len(rows) == 0 {
+			return exitNotFound
+		}
+		return 0
+	case "add", "rm":
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "usage: flightless relays %s <url>...\n", args[0])
+			return 2
+		}
+		failed := 0
+		for _, raw := range args[1:] {
+			url, err := normalizeRelayURL(raw)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", raw, err)
+				failed++
+				continue
+			}
+			var count int64
+			db.Model(&RelayStatus{}).Where("url = ?", url).Count(&count)
+			if args[0] == "add" {
+				if count > 0 {
+					fmt.Printf("%s: already added\n", url)
+					continue
+				}
+				if err := db.Create(&RelayStatus{Url: url, Status: "waiting"}).Error; err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", url, err)
+					failed++
+					continue
+				}
+				fmt.Printf("%s: added\n", url)
+			} else {
+				if count == 0 {
+					fmt.Fprintf(os.Stderr, "%s: not a known relay\n", url)
+					failed++
+					continue
+				}
+				if err := db.Delete(&RelayStatus{}, "url = ?", url).Error; err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", url, err)
+					failed++
+					continue
+				}
+				fmt.Printf("%s: removed\n", url)
+			}
+		}
+		if failed > 0 {
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "unknown relays command: %s\n", args[0])
+	return 2
+}
+
+type accountRow struct {
+	Active bool   `json:"active"`
+	Pubkey string `json:"pubkey"`
+	Npub   string `json:"npub"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+}
+
+func accountType(a Account) string {
+	if a.WatchOnly {
+		return "watch-only"
+	}
+	if a.Bunker != "" {
+		return "remote signer"
+	}
+	return "key"
+}
+
+func cmdAccounts(db *gorm.DB, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: flightless accounts ls [--json] | use <npub>\n")
+		return 2
+	}
+	switch args[0] {
+	case "ls":
+		flags := flag.NewFlagSet("accounts ls", flag.ContinueOnError)
+		asJSON := flags.Bool("json", false, "print json")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+		var accounts []Account
+		db.Find(&accounts)
+		rows := []accountRow{}
+		for _, a := range accounts {
+			var m Metadata
+			db.First(&m, "pubkey_hex = ?", a.Pubkey)
+			rows = append(rows, accountRow{Active: a.Active, Pubkey: a.Pubkey, Npub: a.PubkeyNpub, Name: m.Name, Type: accountType(a)})
+		}
+		if *asJSON {
+			printJSON(rows)
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "ACTIVE\tNAME\tTYPE\tNPUB\n")
+			for _, r := range rows {
+				active := ""
+				if r.Active {
+					active = "*"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", active, r.Name, r.Type, r.Npub)
+			}
+			w.Flush()
+		}
+		if len(rows) == 0 {
+			return exitNotFound
+		}
+		return 0
+	case "use":
+		if len(args) != 2 {
+			fmt.Fprintf(os.Stderr, "usage: flightless accounts use <npub>\n")
+			return 2
+		}
+		pk, err := ParsePubkey(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 2
+		}
+		if err := UseAccount(db, pk); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", args[1], err)
+			return 1
+		}
+		fmt.Printf("%s is now the active account\n", args[1])
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "unknown accounts command: %s\n", args[0])
+	return 2
+}
+
+// sync connects to every relay and ingests like the UI does.  With --once
+// it stops when each relay has sent EOSE or given up, otherwise it runs
+// until interrupted.
+func cmdSync(db *gorm.DB, args []string) int {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	once := flags.Bool("once", false, "stop after every relay has sent its stored events")
+	timeout := flags.Duration("timeout", 2*time.Minute, "give up on slow relays after this long (with --once)")
+	asJSON := flags.Bool("json", false, "print the relay results as json (with --once)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	var urls []string
+	db.Model(&RelayStatus{}).Order("url").Pluck("url", &urls)
+	if len(urls) == 0 {
+		fmt.Fprintf(os.Stderr, "no relays to sync from, add one with 'flightless relays add'\n")
+		return 1
+	}
+	var profilesBefore int64
+	db.Model(&Metadata{}).Count(&profilesBefore)
+
+	startHeadlessPool(db)
+
+	if !*once {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			// same as the UI: fetch from our follows' outboxes once relay
+			// lists have had time to come in
+			time.Sleep(30 * time.Second)
+			planned, succeeded := RunOutboxFetch(db, CTX)
+			TheLog.Printf("outbox fetch: %d of %d relays succeeded", succeeded, planned)
+		}()
+		<-sig
+		// give the relays time to close their connections
+		time.Sleep(time.Second)
+		return 0
+	}
+
+	// a relay is done once it sent EOSE, was skipped, or failed to connect
+	deadline := time.Now().Add(*timeout)
+	states := make(map[string]RelayState)
+	for time.Now().Before(deadline) {
+		done := 0
+		for _, url := range urls {
+			state, retries := Pool.State(url)
+			states[url] = state
+			if state == RelayEOSE || state == RelaySkipped || (state == RelayBackoff && retries > 0) {
+				done++
+			}
+		}
+		if done == len(urls) {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	planned, succeeded := RunOutboxFetch(db, CTX)
+
+	var profilesAfter int64
+	db.Model(&Metadata{}).Count(&profilesAfter)
+	synced := 0
+	type syncRow struct {
+		Url   string `json:"url"`
+		State string `json:"state"`
+	}
+	rows := []syncRow{}
+	for _, url := range urls {
+		if states[url] == RelayEOSE {
+			synced++
+		}
+		rows = append(rows, syncRow{Url: url, State: string(states[url])})
+		Pool.Remove(url)
+	}
+	if *asJSON {
+		printJSON(rows)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "URL\tSTATE\n")
+		for _, r := range rows {
+			fmt.Fprintf(w, "%s\t%s\n", r.Url, r.State)
+		}
+		w.Flush()
+		fmt.Printf("%d of %d relays synced, outbox fetch %d of %d relays, %d profiles (+%d)\n", synced, len(urls), succeeded, planned, profilesAfter, profilesAfter-profilesBefore)
+	}
+	if synced == 0 {
+		return 1
+	}
+	return 0
+}
+
+func cmdSearch(db *gorm.DB, args []string) int {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	limit := flags.Int("limit", 50, "show at most this many profiles")
+	asJSON := flags.Bool("json", false, "print json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	term := strings.TrimSpace(strings.Join(flags.Args(), " "))
+	if term == "" {
+		fmt.Fprintf(os.Stderr, "usage: flightless search [--limit N] [--json] <term>\n")
+		return 2
+	}
+	// same match as the search in the UI
+	like := "%" + term + "%"
+	var metas []Metadata
+	db.Limit(*limit).Order("updated_at desc").Find(&metas, "name like ? or nip05 like ? or pubkey_hex like ? or pubkey_npub like ?", like, like, like, like)
+	printProfiles(profileRows(metas), *asJSON)
+	if len(metas) == 0 {
+		return exitNotFound
+	}
+	return 0
+}
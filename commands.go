@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: flightless [password flags] [command]\n\n")
+	fmt.Fprintf(os.Stderr, "with no command the console UI is started\n\n")
+	fmt.Fprintf(os.Stderr, "password flags, instead of typing the master password:\n")
+	fmt.Fprintf(os.Stderr, "  --password-fd N       read it from file descriptor N\n")
+	fmt.Fprintf(os.Stderr, "  --password-file PATH  read it from a file only we can read (mode 600)\n")
+	fmt.Fprintf(os.Stderr, "  --password-env NAME   read it from environment variable NAME\n\n")
+	fmt.Fprintf(os.Stderr, "commands:\n")
+	fmt.Fprintf(os.Stderr, "  outbox [--all]    list signed events waiting for relays to accept them\n")
+	fmt.Fprintf(os.Stderr, "  passwd            change the master password and re-encrypt all keys\n")
+	fmt.Fprintf(os.Stderr, "  backfill [--to YYYY-MM-DD] [--restart] [relay...]\n")
+	fmt.Fprintf(os.Stderr, "                    fetch older profiles and contact lists, resuming where it left off\n")
+	fmt.Fprintf(os.Stderr, "  unsigned contacts|mute|profile|relays [--account npub] [--text] [npub...]\n")
+	fmt.Fprintf(os.Stderr, "                    build an event for signing offline, as a file or one line of json\n")
+	fmt.Fprintf(os.Stderr, "  import-signed <file|->\n")
+	fmt.Fprintf(os.Stderr, "                    check an event signed offline for a watch-only account and publish it\n")
+	fmt.Fprintf(os.Stderr, "  follows list [--account npub] [--json]\n")
+	fmt.Fprintf(os.Stderr, "                    list who an account follows\n")
+	fmt.Fprintf(os.Stderr, "  follow [--account npub] <npub>...\n")
+	fmt.Fprintf(os.Stderr, "  unfollow [--account npub] <npub>...\n")
+	fmt.Fprintf(os.Stderr, "                    sign and publish a new contact list\n")
+	fmt.Fprintf(os.Stderr, "  relays ls [--json] | add <url>... | rm <url>...\n")
+	fmt.Fprintf(os.Stderr, "  accounts ls [--json] | use <npub>\n")
+	fmt.Fprintf(os.Stderr, "  sync [--once] [--timeout 2m] [--json]\n")
+	fmt.Fprintf(os.Stderr, "                    connect to the relays and ingest, with --once until every relay sent EOSE\n")
+	fmt.Fprintf(os.Stderr, "  search [--limit N] [--json] <term>\n")
+	fmt.Fprintf(os.Stderr, "\nexit status: 0 ok, 1 failed, 2 bad usage, 3 nothing found\n")
+}
+
+// parse the flags before the command, returns the command and its args
+func parseGlobalFlags(args []string) ([]string, error) {
+	flags := flag.NewFlagSet("flightless", flag.ContinueOnError)
+	flags.Usage = usage
+	flags.IntVar(&passwordSource.FD, "password-fd", -1, "read the master password from this file descriptor")
+	flags.StringVar(&passwordSource.File, "password-file", "", "read the master password from this file")
+	flags.StringVar(&passwordSource.Env, "password-env", "", "read the master password from this environment variable")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := passwordSource.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return nil, err
+	}
+	return flags.Args(), nil
+}
+
+// run a headless command, returns the exit code
+func runCommand(db *gorm.DB, args []string) int {
+	switch args[0] {
+	case "outbox":
+		return cmdOutbox(db, args[1:])
+	case "backfill":
+		return cmdBackfill(db, args[1:])
+	case "passwd":
+		return cmdPasswd(db)
+	case "unsigned":
+		return cmdUnsigned(db, args[1:])
+	case "import-signed":
+		return cmdImportSigned(db, args[1:])
+	case "follows":
+		return cmdFollows(db, args[1:])
+	case "follow":
+		return cmdFollow(db, args[1:], false)
+	case "unfollow":
+		return cmdFollow(db, args[1:], true)
+	case "relays":
+		return cmdRelays(db, args[1:])
+	case "accounts":
+		return cmdAccounts(db, args[1:])
+	case "sync":
+		return cmdSync(db, args[1:])
+	case "search":
+		return cmdSearch(db, args[1:])
+	case "help", "-h", "--help":
+		usage()
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", args[0])
+	usage()
+	return 2
+}
+
+func cmdOutbox(db *gorm.DB, args []string) int {
+	all := len(args) > 0 && args[0] == "--all"
+	var events []OutboxEvent
+	if all {
+		db.Order("created_at").Find(&events)
+	} else {
+		events = PendingOutbox(db)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\tKIND\tDESCRIPTION\tACCEPTED\tATTEMPTS\tCREATED\tSTATUS\n")
+	for _, o := range events {
+		status := "pending"
+		if o.ConfirmedAt != nil {
+			status = "confirmed"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d/%d\t%d\t%s\t%s\n", o.ID[:12], o.Kind, o.Description, o.AcceptedCount, outboxMinAccepts, o.Attempts, o.CreatedAt.Format(time.RFC3339), status)
+	}
+	w.Flush()
+	return 0
+}
+
+func cmdPasswd(db *gorm.DB) int {
+	fmt.Println("current password")
+	old, err := GetPwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	// the new password is always typed, the password source holds the old one
+	fmt.Println("new password")
+	newPwd, err := promptNewPwd()
+	if errors.Is(err, errNoTerminal) {
+		fmt.Fprintf(os.Stderr, "the new password must be typed at a terminal\n")
+		return 1
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	if err := ChangePassword(db, old, newPwd); err != nil {
+		fmt.Fprintf(os.Stderr, "password not changed: %s\n", err)
+		return 1
+	}
+	fmt.Println("password changed")
+	return 0
+}
+
+// how long headless commands wait for relays to accept what they publish
+var headlessPublishWait = 30 * time.Second
+
+// connect to every known relay, for headless commands that publish
+func startHeadlessPool(db *gorm.DB) {
+	Tracker.OnAccepted = func(id string, url string) {
+		MarkOutboxAccepted(db, id, url)
+	}
+	Pool = NewRelayPool(db, CTX)
+	var urls []string
+	db.Model(&RelayStatus{}).Pluck("url", &urls)
+	for _, url := range urls {
+		Pool.Add(url)
+	}
+}
+
+// wait until a queued event has been accepted by enough relays
+func waitForOutbox(db *gorm.DB, id string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		var o OutboxEvent
+		if db.First(&o, "id = ?", id).Error == nil && o.ConfirmedAt != nil {
+			return true
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return false
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"gorm.io/gorm"
+)
+
+var errKeysLocked = errors.New("keys are locked")
+var errNoKey = errors.New("no private key for this account")
+var errWatchOnly = errors.New("watch-only account, it has no private key")
+
+// KeyStore holds the decrypted private keys of every account, so the rest
+// of the app signs by pubkey and never handles raw keys
+type KeyStore struct {
+	mu       sync.Mutex
+	unlocked bool
+	password []byte
+	keys     map[string][]byte        // pubkey -> hex private key, wiped on Lock
+	failed   map[string]error         // pubkey -> why its key could not be decrypted
+	remote   map[string]*BunkerSigner // pubkey -> NIP-46 remote signer
+}
+
+var Keys = NewKeyStore()
+
+func NewKeyStore() *KeyStore {
+	return &KeyStore{keys: make(map[string][]byte), failed: make(map[string]error), remote: make(map[string]*BunkerSigner)}
+}
+
+// Unlock decrypts every account's key with the master password.  Keys that
+// fail to decrypt are remembered with their error, the first of which is
+// returned; the rest are usable.
+func (k *KeyStore) Unlock(db *gorm.DB, password []byte) error {
+	var accounts []Account
+	if err := db.Find(&accounts).Error; err != nil {
+		return err
+	}
+	keys := make(map[string][]byte)
+	failed := make(map[string]error)
+	remote := make(map[string]*BunkerSigner)
+	var firstErr error
+	for _, account := range accounts {
+		if account.WatchOnly {
+			failed[account.Pubkey] = errWatchOnly
+			continue
+		}
+		if account.Bunker != "" {
+			signer, err := bunkerSignerFor(password, account)
+			if err != nil {
+				failed[account.Pubkey] = err
+				if firstErr == nil {
+					firstErr = fmt.Errorf("account %s: %w", account.PubkeyNpub, err)
+				}
+				continue
+			}
+			remote[account.Pubkey] = signer
+			continue
+		}
+		sk, err := decryptAccountKey(password, account)
+		if err != nil {
+			failed[account.Pubkey] = err
+			if firstErr == nil {
+				firstErr = fmt.Errorf("account %s: %w", account.PubkeyNpub, err)
+			}
+			continue
+		}
+		keys[account.Pubkey] = []byte(sk)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.wipe()
+	k.unlocked = true
+	k.password = append([]byte(nil), password...)
+	k.keys = keys
+	k.failed = failed
+	k.remote = remote
+	return firstErr
+}
+
+// decrypt an account's key and check that it belongs to the account
+func decryptAccountKey(password []byte, account Account) (string, error) {
+	sk, err := Decrypt(string(password), account.Privatekey)
+	if err != nil {
+		return "", err
+	}
+	// a remote signer account stores our client key, which has its own pubkey
+	if account.Bunker != "" {
+		return sk, nil
+	}
+	if pk, err := nostr.GetPublicKey(sk); err != nil || pk != account.Pubkey {
+		return "", errors.New("stored key does not match pubkey")
+	}
+	return sk, nil
+}
+
+// a bunker account's private key is the client key we talk to the signer
+// with, not the account's own key
+func bunkerSignerFor(password []byte, account Account) (*BunkerSigner, error) {
+	uri, err := ParseBunkerURI(account.Bunker)
+	if err != nil {
+		return nil, err
+	}
+	clientSK, err := Decrypt(string(password), account.Privatekey)
+	if err != nil {
+		return nil, err
+	}
+	return NewBunkerSigner(uri, clientSK)
+}
+
+// Status is nil when pubkey can sign, or why it can't
+func (k *KeyStore) Status(pubkey string) error {
+	if _, found := k.signer(pubkey); found {
+		return nil
+	}
+	_, err := k.key(pubkey)
+	return err
+}
+
+// IsRemote is true when pubkey signs with a remote signer, which may take
+// a while to answer
+func (k *KeyStore) IsRemote(pubkey string) bool {
+	_, found := k.signer(pubkey)
+	return found
+}
+
+func (k *KeyStore) signer(pubkey string) (*BunkerSigner, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if !k.unlocked {
+		return nil, false
+	}
+	signer, found := k.remote[pubkey]
+	return signer, found
+}
+
+func (k *KeyStore) key(pubkey string) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if !k.unlocked {
+		return "", errKeysLocked
+	}
+	if err, found := k.failed[pubkey]; found {
+		return "", err
+	}
+	sk, found := k.keys[pubkey]
+	if !found {
+		return "", errNoKey
+	}
+	return string(sk), nil
+}
+
+// Sign sets the id, pubkey and signature of ev with pubkey's key
+func (k *KeyStore) Sign(pubkey string, ev *nostr.Event) error {
+	ctx, cancel := context.WithTimeout(CTX, bunkerTimeout)
+	defer cancel()
+	return k.SignWithApproval(ctx, pubkey, ev, nil)
+}
+
+// SignWithApproval is Sign, but a remote signer can be cancelled with ctx
+// and onAuthURL is called if it asks the user to approve somewhere
+func (k *KeyStore) SignWithApproval(ctx context.Context, pubkey string, ev *nostr.Event, onAuthURL func(string)) error {
+	if signer, found := k.signer(pubkey); found {
+		if ev.PubKey != "" && ev.PubKey != pubkey {
+			return fmt.Errorf("event is for %s, not %s", ev.PubKey, pubkey)
+		}
+		ev.PubKey = pubkey
+		return signer.SignEvent(ctx, ev, onAuthURL)
+	}
+	sk, err := k.key(pubkey)
+	if err != nil {
+		return err
+	}
+	if ev.PubKey != "" && ev.PubKey != pubkey {
+		return fmt.Errorf("event is for %s, not %s", ev.PubKey, pubkey)
+	}
+	ev.PubKey = pubkey
+	if err := ev.Sign(sk); err != nil {
+		return err
+	}
+	if ok, err := ev.CheckSignature(); err != nil || !ok {
+		return errors.New("produced an invalid signature")
+	}
+	return nil
+}
+
+// Reveal returns pubkey's private key, for showing it to the user
+func (k *KeyStore) Reveal(pubkey string) (string, error) {
+	if k.IsRemote(pubkey) {
+		return "", errors.New("the key is held by a remote signer")
+	}
+	return k.key(pubkey)
+}
+
+// Add stores a private key as a new account, encrypted with the master
+// password, and makes it the active account
+func (k *KeyStore) Add(db *gorm.DB, sk string) (Account, error) {
+	sk = strings.TrimSpace(sk)
+	if len(sk) != 64 || !isHex(sk) {
+		return Account{}, errors.New("private key must be 64 hex characters")
+	}
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		return Account{}, err
+	}
+	npub, err := nip19.EncodePublicKey(pk)
+	if err != nil {
+		return Account{}, err
+	}
+
+	k.mu.Lock()
+	if !k.unlocked {
+		k.mu.Unlock()
+		return Account{}, errKeysLocked
+	}
+	// a copy, Lock may wipe the original while we work
+	password := string(k.password)
+	k.mu.Unlock()
+
+	// a watch-only account for the same pubkey is replaced by the full one
+	var existing int64
+	db.Model(&Account{}).Where("pubkey = ? and watch_only = ?", pk, false).Count(&existing)
+	if existing > 0 {
+		return Account{}, fmt.Errorf("account %s already exists", npub)
+	}
+	account := Account{Privatekey: Encrypt(password, sk), Pubkey: pk, PubkeyNpub: npub, Active: true}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("pubkey = ? and watch_only = ?", pk, true).Delete(&Account{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Account{}).Where("active = ?", true).Update("active", false).Error; err != nil {
+			return err
+		}
+		return tx.Create(&account).Error
+	})
+	if err != nil {
+		return Account{}, err
+	}
+
+	k.mu.Lock()
+	k.keys[pk] = []byte(sk)
+	delete(k.failed, pk)
+	k.mu.Unlock()
+	Bus.Publish(BusMessage{Topic: TopicAccount})
+	return account, nil
+}
+
+// AddBunker connects to the remote signer in a bunker:// uri with a new
+// client key, and stores it as the active account for the pubkey the
+// signer reports.  onAuthURL is called if the signer wants the connection
+// approved somewhere.
+func (k *KeyStore) AddBunker(ctx context.Context, db *gorm.DB, rawURI string, onAuthURL func(string)) (Account, error) {
+	rawURI = strings.TrimSpace(rawURI)
+	uri, err := ParseBunkerURI(rawURI)
+	if err != nil {
+		return Account{}, err
+	}
+
+	k.mu.Lock()
+	if !k.unlocked {
+		k.mu.Unlock()
+		return Account{}, errKeysLocked
+	}
+	// a copy, Lock may wipe the original while we work
+	password := string(k.password)
+	k.mu.Unlock()
+
+	clientSK := nostr.GeneratePrivateKey()
+	signer, err := NewBunkerSigner(uri, clientSK)
+	if err != nil {
+		return Account{}, err
+	}
+	pk, err := signer.Connect(ctx, onAuthURL)
+	if err != nil {
+		signer.Close()
+		return Account{}, err
+	}
+	npub, err := nip19.EncodePublicKey(pk)
+	if err != nil {
+		signer.Close()
+		return Account{}, err
+	}
+
+	// like Add, a watch-only account for the same pubkey is replaced
+	var existing int64
+	db.Model(&Account{}).Where("pubkey = ? and watch_only = ?", pk, false).Count(&existing)
+	if existing > 0 {
+		signer.Close()
+		return Account{}, fmt.Errorf("account %s already exists", npub)
+	}
+	account := Account{Privatekey: Encrypt(password, clientSK), Pubkey: pk, PubkeyNpub: npub, Bunker: rawURI, Active: true}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("pubkey = ? and watch_only = ?", pk, true).Delete(&Account{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Account{}).Where("active = ?", true).Update("active", false).Error; err != nil {
+			return err
+		}
+		return tx.Create(&account).Error
+	})
+	if err != nil {
+		signer.Close()
+		return Account{}, err
+	}
+
+	k.mu.Lock()
+	k.remote[pk] = signer
+	delete(k.failed, pk)
+	k.mu.Unlock()
+	Bus.Publish(BusMessage{Topic: TopicAccount})
+	return account, nil
+}
+
+// AddWatchOnly stores an account with just a pubkey and makes it active.
+// Nothing can be signed for it.
+func (k *KeyStore) AddWatchOnly(db *gorm.DB, s string) (Account, error) {
+	pk, err := ParsePubkey(s)
+	if err != nil {
+		return Account{}, err
+	}
+	npub, err := nip19.EncodePublicKey(pk)
+	if err != nil {
+		return Account{}, err
+	}
+	var existing int64
+	db.Model(&Account{}).Where("pubkey = ?", pk).Count(&existing)
+	if existing > 0 {
+		return Account{}, fmt.Errorf("account %s already exists", npub)
+	}
+	account := Account{Pubkey: pk, PubkeyNpub: npub, WatchOnly: true, Active: true}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Account{}).Where("active = ?", true).Update("active", false).Error; err != nil {
+			return err
+		}
+		return tx.Create(&account).Error
+	})
+	if err != nil {
+		return Account{}, err
+	}
+
+	k.mu.Lock()
+	k.failed[pk] = errWatchOnly
+	k.mu.Unlock()
+	Bus.Publish(BusMessage{Topic: TopicAccount})
+	return account, nil
+}
+
+// Forget drops a deleted account's key
+func (k *KeyStore) Forget(pubkey string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	wipe(k.keys[pubkey])
+	delete(k.keys, pubkey)
+	delete(k.failed, pubkey)
+	if signer, found := k.remote[pubkey]; found {
+		signer.Close()
+		delete(k.remote, pubkey)
+	}
+}
+
+// Lock wipes every decrypted key and the password.  Nothing can be signed
+// or revealed until Unlock is called again.
+func (k *KeyStore) Lock() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.wipe()
+	k.unlocked = false
+}
+
+func (k *KeyStore) Locked() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return !k.unlocked
+}
+
+// zero and drop the key material, with k.mu held
+func (k *KeyStore) wipe() {
+	for _, sk := range k.keys {
+		wipe(sk)
+	}
+	wipe(k.password)
+	for _, signer := range k.remote {
+		signer.Close()
+	}
+	k.password = nil
+	k.keys = make(map[string][]byte)
+	k.failed = make(map[string]error)
+	k.remote = make(map[string]*BunkerSigner)
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
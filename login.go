@@ -7,18 +7,37 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
 	"os"
+	"strconv"
 	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/crypto/pbkdf2"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
+// key encryption parameters, tunable with KDF_TIME, KDF_MEMORY_KB and
+// KDF_THREADS.  They are stored with each ciphertext so changing them only
+// affects newly encrypted keys.
+var kdfTime = envInt("KDF_TIME", 3)
+var kdfMemory = envInt("KDF_MEMORY_KB", 64*1024)
+var kdfThreads = envInt("KDF_THREADS", 4)
+
+// bcrypt cost of the login hash, tunable with BCRYPT_COST
+var bcryptCost = envInt("BCRYPT_COST", 12)
+
+// current ciphertext format: v2:<time>:<memory>:<threads>:<salt>:<iv>:<data>
+// with an argon2id derived AES-256-GCM key.  The old format is the PBKDF2
+// salt-iv-data.
+const cipherV2 = "v2:"
+
 func Encrypt(passphrase, plaintext string) string {
-	key, salt := DeriveKey(passphrase, nil)
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	key := deriveKeyV2(passphrase, salt, uint32(kdfTime), uint32(kdfMemory), uint8(kdfThreads))
 	iv := make([]byte, 12)
 	// http://nvlpubs.nist.gov/nistpubs/Legacy/SP/nistspecialpublication800-38d.pdf
 	// Section 8.2
@@ -26,19 +45,73 @@ func Encrypt(passphrase, plaintext string) string {
 	b, _ := aes.NewCipher(key)
 	aesgcm, _ := cipher.NewGCM(b)
 	data := aesgcm.Seal(nil, iv, []byte(plaintext), nil)
-	return hex.EncodeToString(salt) + "-" + hex.EncodeToString(iv) + "-" + hex.EncodeToString(data)
+	return fmt.Sprintf("%s%d:%d:%d:%s:%s:%s", cipherV2, kdfTime, kdfMemory, kdfThreads,
+		hex.EncodeToString(salt), hex.EncodeToString(iv), hex.EncodeToString(data))
 }
 
-func Decrypt(passphrase, ciphertext string) string {
+func deriveKeyV2(passphrase string, salt []byte, time uint32, memory uint32, threads uint8) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, time, memory, threads, 32)
+}
+
+// the ciphertext is in the old PBKDF2 format and should be re-encrypted
+func isLegacyCiphertext(ciphertext string) bool {
+	return !strings.HasPrefix(ciphertext, cipherV2)
+}
+
+// Decrypt reports a malformed ciphertext or a wrong passphrase instead of
+// returning an empty key
+func Decrypt(passphrase, ciphertext string) (string, error) {
+	if isLegacyCiphertext(ciphertext) {
+		return decryptLegacy(passphrase, ciphertext)
+	}
+	arr := strings.Split(strings.TrimPrefix(ciphertext, cipherV2), ":")
+	if len(arr) != 6 {
+		return "", errors.New("malformed ciphertext")
+	}
+	time, err1 := strconv.ParseUint(arr[0], 10, 32)
+	memory, err2 := strconv.ParseUint(arr[1], 10, 32)
+	threads, err3 := strconv.ParseUint(arr[2], 10, 8)
+	salt, err4 := hex.DecodeString(arr[3])
+	iv, err5 := hex.DecodeString(arr[4])
+	data, err6 := hex.DecodeString(arr[5])
+	for _, err := range []error{err1, err2, err3, err4, err5, err6} {
+		if err != nil {
+			return "", errors.New("malformed ciphertext")
+		}
+	}
+	if len(iv) != 12 || time == 0 || threads == 0 {
+		return "", errors.New("malformed ciphertext")
+	}
+	key := deriveKeyV2(passphrase, salt, uint32(time), uint32(memory), uint8(threads))
+	b, _ := aes.NewCipher(key)
+	aesgcm, _ := cipher.NewGCM(b)
+	plaintext, err := aesgcm.Open(nil, iv, data, nil)
+	if err != nil {
+		return "", errors.New("wrong password or corrupt key")
+	}
+	return string(plaintext), nil
+}
+
+// the original salt-iv-data format, PBKDF2 with 1000 iterations
+func decryptLegacy(passphrase, ciphertext string) (string, error) {
 	arr := strings.Split(ciphertext, "-")
-	salt, _ := hex.DecodeString(arr[0])
-	iv, _ := hex.DecodeString(arr[1])
-	data, _ := hex.DecodeString(arr[2])
+	if len(arr) != 3 {
+		return "", errors.New("malformed ciphertext")
+	}
+	salt, err1 := hex.DecodeString(arr[0])
+	iv, err2 := hex.DecodeString(arr[1])
+	data, err3 := hex.DecodeString(arr[2])
+	if err1 != nil || err2 != nil || err3 != nil || len(iv) != 12 {
+		return "", errors.New("malformed ciphertext")
+	}
 	key, _ := DeriveKey(passphrase, salt)
 	b, _ := aes.NewCipher(key)
 	aesgcm, _ := cipher.NewGCM(b)
-	data, _ = aesgcm.Open(nil, iv, data, nil)
-	return string(data)
+	data, err := aesgcm.Open(nil, iv, data, nil)
+	if err != nil {
+		return "", errors.New("wrong password or corrupt key")
+	}
+	return string(data), nil
 }
 
 func DeriveKey(passphrase string, salt []byte) ([]byte, []byte) {
@@ -51,73 +124,82 @@ func DeriveKey(passphrase string, salt []byte) ([]byte, []byte) {
 	return pbkdf2.Key([]byte(passphrase), salt, 1000, 32, sha256.New), salt
 }
 
-func GetNewPwd() []byte {
-	// Prompt the user to enter a password
-	fmt.Println("Enter password")
-	// We will use this to store the users input
-	// Read the users input
-	//pwd1, err := term.ReadPassword(syscall.Stdin)
-	pwd1, err := terminal.ReadPassword(int(os.Stdin.Fd()))
-
-	fmt.Println("Confirm password")
-	pwd2, err2 := terminal.ReadPassword(int(os.Stdin.Fd()))
-	//pwd2, err2 := term.ReadPassword(syscall.Stdin)
-	if err != nil || err2 != nil {
-		log.Println(err)
-	}
+var errNoTerminal = errors.New("stdin is not a terminal, pass the password with --password-fd, --password-file or --password-env")
 
-	if bytes.Equal(pwd1, pwd2) == false {
-		log.Println("Passwords do not match")
-		os.Exit(1)
+// GetNewPwd asks for a new password twice, or reads it from the password
+// source
+func GetNewPwd() ([]byte, error) {
+	if passwordSource.Set() {
+		return passwordSource.Read()
 	}
-
-	// Return the users input as a byte slice which will save us
-	// from having to do this conversion later on
-	return pwd1
+	return promptNewPwd()
 }
 
-func GetPwd() []byte {
-	// Prompt the user to enter a password
+// ask for a new password twice at the terminal
+func promptNewPwd() ([]byte, error) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, errNoTerminal
+	}
 	fmt.Println("Enter password")
-	// We will use this to store the users input
-
-	// Read the users input
-	//	pwd1, err := term.ReadPassword(syscall.Stdin)
 	pwd1, err := terminal.ReadPassword(int(os.Stdin.Fd()))
 	if err != nil {
-		log.Println(err)
+		return nil, fmt.Errorf("reading password: %w", err)
+	}
+	fmt.Println("Confirm password")
+	pwd2, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("reading password: %w", err)
+	}
+	if !bytes.Equal(pwd1, pwd2) {
+		return nil, errors.New("passwords do not match")
+	}
+	if len(pwd1) == 0 {
+		return nil, errors.New("password is empty")
 	}
+	return pwd1, nil
+}
 
-	// Return the users input as a byte slice which will save us
-	// from having to do this conversion later on
-	return pwd1
+// GetPwd asks for the master password, or reads it from the password
+// source
+func GetPwd() ([]byte, error) {
+	if passwordSource.Set() {
+		return passwordSource.Read()
+	}
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, errNoTerminal
+	}
+	// on stderr, stdout may be piped into a script
+	fmt.Fprintln(os.Stderr, "Enter password")
+	pwd, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("reading password: %w", err)
+	}
+	return pwd, nil
 }
 
-func HashAndSalt(pwd []byte) string {
+func HashAndSalt(pwd []byte) (string, error) {
 
 	// Use GenerateFromPassword to hash & salt pwd
-	// MinCost is just an integer constant provided by the bcrypt
-	// package along with DefaultCost & MaxCost.
 	// The cost can be any value you want provided it isn't lower
-	// than the MinCost (4)
-	hash, err := bcrypt.GenerateFromPassword(pwd, bcrypt.MinCost)
+	// than the MinCost (4), see BCRYPT_COST
+	hash, err := bcrypt.GenerateFromPassword(pwd, bcryptCost)
 	if err != nil {
-		log.Println(err)
+		return "", err
 	}
 	// GenerateFromPassword returns a byte slice so we need to
 	// convert the bytes to a string and return it
-	return string(hash)
+	return string(hash), nil
 }
 
-func ComparePasswords(hashedPwd string, plainPwd []byte) bool {
-	// Since we'll be getting the hashed password from the DB it
-	// will be a string so we'll need to convert it to a byte slice
-	byteHash := []byte(hashedPwd)
-	err := bcrypt.CompareHashAndPassword(byteHash, plainPwd)
+// ComparePasswords is nil when plainPwd matches the hash, errWrongPassword
+// when it doesn't, or why the hash couldn't be checked
+func ComparePasswords(hashedPwd string, plainPwd []byte) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hashedPwd), plainPwd)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return errWrongPassword
+	}
 	if err != nil {
-		log.Println(err)
-		return false
+		return fmt.Errorf("bad login hash: %w", err)
 	}
-
-	return true
+	return nil
 }
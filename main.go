@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -17,22 +19,27 @@ import (
 var AppInfo = "flightless v0.0.5"
 
 type Metadata struct {
-	PubkeyHex         string `gorm:"primaryKey;size:65"`
-	PubkeyNpub        string `gorm:"size:65"`
-	Name              string `gorm:"size:1024"`
-	About             string `gorm:"size:4096"`
-	Nip05             string `gorm:"size:512"`
-	Lud06             string `gorm:"size:2048"`
-	Lud16             string `gorm:"size:512"`
-	Website           string `gorm:"size:512"`
-	DisplayName       string `gorm:"size:512"`
-	Picture           string `gorm:"type:text;size:65535"`
-	TotalFollows      int
-	UpdatedAt         time.Time `gorm:"autoUpdateTime"`
-	ContactsUpdatedAt time.Time
-	MetadataUpdatedAt time.Time
-	Follows           []*Metadata       `gorm:"many2many:metadata_follows"`
-	Servers           []RecommendServer `gorm:"foreignKey:PubkeyHex;references:PubkeyHex"`
+	PubkeyHex          string `gorm:"primaryKey;size:65"`
+	PubkeyNpub         string `gorm:"size:65"`
+	Name               string `gorm:"size:1024"`
+	About              string `gorm:"size:4096"`
+	Nip05              string `gorm:"size:512"`
+	Lud06              string `gorm:"size:2048"`
+	Lud16              string `gorm:"size:512"`
+	Website            string `gorm:"size:512"`
+	DisplayName        string `gorm:"size:512"`
+	Picture            string `gorm:"type:text;size:65535"`
+	MetadataContent    string `gorm:"type:text"` // kind 0 content as published, with fields we don't keep
+	MuteList           string `gorm:"type:text"` // newest kind 10000 of an account, signed event json
+	TotalFollows       int
+	UpdatedAt          time.Time `gorm:"autoUpdateTime"`
+	ContactsUpdatedAt  time.Time
+	MetadataUpdatedAt  time.Time
+	RelayListUpdatedAt time.Time
+	MuteListUpdatedAt  time.Time
+	Follows            []*Metadata       `gorm:"many2many:metadata_follows"`
+	Servers            []RecommendServer `gorm:"foreignKey:PubkeyHex;references:PubkeyHex"`
+	RelayList          []RelayListEntry  `gorm:"foreignKey:PubkeyHex;references:PubkeyHex"`
 }
 
 type RecommendServer struct {
@@ -44,19 +51,102 @@ type RecommendServer struct {
 	RecommendedBy string    `gorm:"size:256"`
 }
 
+// NIP-65 relay list metadata (kind 10002)
+type RelayListEntry struct {
+	ID        int64  `gorm:"primaryKey;autoIncrement"`
+	PubkeyHex string `gorm:"size:65;index"`
+	Url       string `gorm:"size:512"`
+	Read      bool
+	Write     bool
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
 type RelayStatus struct {
 	Url       string    `gorm:"primaryKey;size:512"`
 	Status    string    `gorm:"size:512"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 	LastEOSE  time.Time
 	LastDisco time.Time
+	Retries   int
+	AllowAuth bool // answer NIP-42 AUTH challenges with the active account
+}
+
+// NIP-11 relay information document
+type RelayInfo struct {
+	Url              string `gorm:"primaryKey;size:512"`
+	Name             string `gorm:"size:512"`
+	Description      string `gorm:"size:4096"`
+	Pubkey           string `gorm:"size:65"`
+	Contact          string `gorm:"size:512"`
+	Software         string `gorm:"size:512"`
+	Version          string `gorm:"size:256"`
+	SupportedNips    string `gorm:"size:1024"` // comma separated
+	MaxMessageLength int
+	MaxSubscriptions int
+	MaxFilters       int
+	MaxLimit         int
+	MaxEventTags     int
+	MaxContentLength int
+	MinPowDifficulty int
+	AuthRequired     bool
+	PaymentRequired  bool
+	FetchedAt        time.Time
+	UpdatedAt        time.Time `gorm:"autoUpdateTime"`
 }
 
 type Account struct {
 	Pubkey     string `gorm:"primaryKey;size:65"`
 	PubkeyNpub string `gorm:"size:65"`
-	Privatekey string `gorm:"primaryKey;size:65"` // encrypted
+	Privatekey string `gorm:"primaryKey;size:65"` // encrypted, empty for watch-only
 	Active     bool
+	WatchOnly  bool   // just a pubkey, nothing can be signed
+	Bunker     string `gorm:"size:1024"` // NIP-46 bunker:// uri, Privatekey is then our client key
+}
+
+// hourly relay health counters
+type RelayMetric struct {
+	Url           string    `gorm:"primaryKey;size:512"`
+	Hour          time.Time `gorm:"primaryKey"`
+	Events        int
+	EventsByKind  string `gorm:"size:2048"` // json kind -> count
+	Bytes         int64
+	Duplicates    int
+	InvalidSigs   int
+	Connects      int
+	ConnectMs     int64 // total, divide by Connects
+	Eoses         int
+	EoseMs        int64 // total, divide by Eoses
+	PublishOK     int
+	PublishFailed int
+}
+
+// signed events waiting to be accepted by enough relays
+type OutboxEvent struct {
+	ID             string `gorm:"primaryKey;size:65"`
+	Pubkey         string `gorm:"size:65"`
+	Kind           int
+	Description    string `gorm:"size:512"`
+	Raw            string `gorm:"type:text"` // signed event json
+	AcceptedRelays string `gorm:"type:text"` // space separated
+	AcceptedCount  int
+	Attempts       int
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
+	ConfirmedAt    *time.Time
+}
+
+// how far back the backfill command has walked a relay
+type BackfillProgress struct {
+	Url       string    `gorm:"primaryKey;size:512"`
+	Until     time.Time // oldest created_at reached so far
+	Events    int64
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+// one-off data migrations that have been applied
+type Migration struct {
+	Name      string    `gorm:"primaryKey;size:128"`
+	AppliedAt time.Time `gorm:"autoCreateTime"`
 }
 
 type Login struct {
@@ -105,6 +195,8 @@ var Password []byte
 
 var CTX context.Context
 
+var Pool *RelayPool
+
 func main() {
 
 	/*
@@ -117,6 +209,7 @@ func main() {
 	CTX = context.Background()
 
 	DB := GetGormConnection()
+	countBadSignatures()
 	ViewDB = DB
 
 	migrateErr := DB.AutoMigrate(&Metadata{})
@@ -124,6 +217,12 @@ func main() {
 	migrateErr3 := DB.AutoMigrate(&RecommendServer{})
 	migrateErr4 := DB.AutoMigrate(&Login{})
 	migrateErr5 := DB.AutoMigrate(&Account{})
+	migrateErr6 := DB.AutoMigrate(&RelayInfo{})
+	migrateErr7 := DB.AutoMigrate(&RelayListEntry{})
+	migrateErr8 := DB.AutoMigrate(&OutboxEvent{})
+	migrateErr9 := DB.AutoMigrate(&RelayMetric{})
+	migrateErr10 := DB.AutoMigrate(&BackfillProgress{})
+	migrateErr11 := DB.AutoMigrate(&Migration{})
 
 	migrateErrs := []error{
 		migrateErr,
@@ -131,13 +230,35 @@ func main() {
 		migrateErr3,
 		migrateErr4,
 		migrateErr5,
+		migrateErr6,
+		migrateErr7,
+		migrateErr8,
+		migrateErr9,
+		migrateErr10,
+		migrateErr11,
 	}
 	for i, err := range migrateErrs {
 		if err != nil {
-			fmt.Println("Error running a migration (%d) %s\nexiting.", i, err)
+			fmt.Printf("Error running a migration (%d) %s\nexiting.\n", i, err)
 			os.Exit(1)
 		}
 	}
+	if err := runMigration(DB, "normalize relay urls", MergeRelayUrls); err != nil {
+		fmt.Printf("Error normalizing relay urls %s\nexiting.\n", err)
+		os.Exit(1)
+	}
+
+	args, err := parseGlobalFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		os.Exit(2)
+	}
+
+	// headless commands
+	if len(args) > 0 {
+		os.Exit(runCommand(DB, args))
+	}
 
 	// Login
 
@@ -146,19 +267,37 @@ func main() {
 
 	if loginDbErr != nil || login.PasswordHash == "" {
 		fmt.Println("no login found, create a new password")
-		Password = GetNewPwd()
-		login.PasswordHash = HashAndSalt(Password)
+		Password, err = GetNewPwd()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "login not created: %s\n", err)
+			os.Exit(1)
+		}
+		login.PasswordHash, err = HashAndSalt(Password)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "login not created: %s\n", err)
+			os.Exit(1)
+		}
 		DB.Create(&login)
 		fmt.Println("login created, loading...")
 	} else {
-		Password = GetPwd()
-		success := ComparePasswords(login.PasswordHash, Password)
-		if success {
-			fmt.Println("login success, loading...")
-		} else {
-			fmt.Println("login failed")
+		Password, err = GetPwd()
+		if err == nil {
+			err = ComparePasswords(login.PasswordHash, Password)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "login failed: %s\n", err)
 			os.Exit(1)
 		}
+		fmt.Println("login success, loading...")
+		if n, err := UpgradeKeyEncryption(DB, Password); err != nil {
+			fmt.Printf("could not upgrade key encryption: %s\n", err)
+		} else if n > 0 {
+			fmt.Printf("upgraded encryption of %d keys\n", n)
+		}
+	}
+
+	if err := Keys.Unlock(DB, Password); err != nil {
+		fmt.Printf("some keys could not be decrypted: %s\n", err)
 	}
 
 	// connect to relay(s)
@@ -166,7 +305,8 @@ func main() {
 	var relayUrls []string
 	var relayStatuses []RelayStatus
 	DB.Find(&relayStatuses)
-	if len(relayStatuses) == 0 {
+	firstRun := len(relayStatuses) == 0
+	if firstRun {
 		fmt.Println("error finding relay urls")
 		relayUrls = []string{
 			//"wss://relay.snort.social",
@@ -183,54 +323,59 @@ func main() {
 		}
 	}
 
-	for _, url := range relayUrls {
-		doRelay(DB, CTX, url)
+	// count relay acceptances for queued events
+	Tracker.OnAccepted = func(id string, url string) {
+		MarkOutboxAccepted(DB, id, url)
 	}
 
+	go Metrics.Run(DB)
+
 	g, err := gocui.NewGui(gocui.OutputTrue, true)
 	if err != nil {
 		log.Panicln(err)
 	}
 	defer g.Close()
 
+	// relay, ingestion and outbox events update the views
+	subscribeUI(g)
+
+	// live publish results
+	Tracker.OnChange = func(id string) {
+		g.Update(func(g *gocui.Gui) error {
+			if id == publishStatusID {
+				return refreshPublishStatus(g)
+			}
+			return nil
+		})
+	}
+
+	// the tracker callbacks are set before any relay can publish
+	Pool = NewRelayPool(DB, CTX)
+	for _, url := range relayUrls {
+		Pool.Add(url)
+	}
+
+	// lock the keys when idle, before any view is created
+	watchIdle(g)
+
 	g.SetManagerFunc(layout)
 	if err := keybindings(g); err != nil {
 		log.Panicln(err)
 	}
 
-	// relay status manager
+	// fetch from the relays our follows publish to, once the initial
+	// subscriptions have had time to fill in relay lists
 	go func() {
-		for {
-			var RelayStatuses []RelayStatus
-			DB.Find(&RelayStatuses)
-			for _, relayStatus := range RelayStatuses {
-				if relayStatus.Status == "waiting" {
-					doRelay(DB, CTX, relayStatus.Url)
-				} else if relayStatus.Status == "deleting" {
-					foundit := false
-					for _, r := range nostrRelays {
-						if r.URL == relayStatus.Url {
-							err := DB.Delete(&relayStatus).Error
-							if err != nil {
-								fmt.Println(err)
-							}
-							foundit = true
-							r.Close()
-						}
-					}
-					// if we didn't find it, delete the record anyway
-					if !foundit {
-						err := DB.Delete(&relayStatus).Error
-						if err != nil {
-							fmt.Println(err)
-						}
-					}
-				}
-			}
-			time.Sleep(1 * time.Second)
-		}
+		time.Sleep(30 * time.Second)
+		planned, succeeded := RunOutboxFetch(DB, CTX)
+		TheLog.Printf("outbox fetch: %d of %d relays succeeded", succeeded, planned)
 	}()
 
+	// first run: offer to use our published relay list once it arrives
+	if firstRun {
+		offerSeedRelaysOnArrival(g)
+	}
+
 	if err := g.MainLoop(); err != nil && err != gocui.ErrQuit {
 		log.Panicln(err)
 	}
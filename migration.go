@@ -0,0 +1,19 @@
+package main
+
+import "gorm.io/gorm"
+
+// runMigration applies fn in a transaction the first time it sees name, and
+// records it so that later starts skip it
+func runMigration(db *gorm.DB, name string, fn func(tx *gorm.DB) error) error {
+	var done Migration
+	if db.First(&done, "name = ?", name).Error == nil {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		TheLog.Printf("applied migration %q\n", name)
+		return tx.Create(&Migration{Name: name}).Error
+	})
+}
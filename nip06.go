@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/tyler-smith/go-bip32"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// GenerateMnemonic returns 24 new BIP-39 words
+func GenerateMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(256)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// normalize spacing and case of typed in words
+func cleanMnemonic(words string) string {
+	return strings.Join(strings.Fields(strings.ToLower(words)), " ")
+}
+
+// KeyFromMnemonic derives the NIP-06 private key m/44'/1237'/<account>'/0/0
+func KeyFromMnemonic(words string, account uint32) (string, error) {
+	words = cleanMnemonic(words)
+	if !bip39.IsMnemonicValid(words) {
+		return "", errors.New("invalid mnemonic")
+	}
+	if account >= bip32.FirstHardenedChild {
+		return "", errors.New("account index too large")
+	}
+	key, err := bip32.NewMasterKey(bip39.NewSeed(words, ""))
+	if err != nil {
+		return "", err
+	}
+	path := []uint32{
+		bip32.FirstHardenedChild + 44,
+		bip32.FirstHardenedChild + 1237,
+		bip32.FirstHardenedChild + account,
+		0,
+		0,
+	}
+	for _, idx := range path {
+		key, err = key.NewChildKey(idx)
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(key.Key), nil
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+)
+
+const KindNostrConnect = 24133
+
+// how long a remote signer has to answer, including the user approving
+var bunkerTimeout = 2 * time.Minute
+
+var errBunkerClosed = errors.New("remote signer connection closed")
+
+// a parsed bunker://<remote signer pubkey>?relay=...&secret=... uri
+type BunkerURI struct {
+	Pubkey string
+	Relays []string
+	Secret string
+}
+
+func ParseBunkerURI(s string) (BunkerURI, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "bunker" {
+		return BunkerURI{}, errors.New("not a bunker:// uri")
+	}
+	pk := u.Host
+	if len(pk) != 64 || !isHex(pk) {
+		return BunkerURI{}, errors.New("bunker uri has no valid remote signer pubkey")
+	}
+	b := BunkerURI{Pubkey: pk, Secret: u.Query().Get("secret")}
+	for _, r := range u.Query()["relay"] {
+		if n, err := normalizeRelayURL(r); err == nil {
+			b.Relays = append(b.Relays, n)
+		}
+	}
+	if len(b.Relays) == 0 {
+		return BunkerURI{}, errors.New("bunker uri has no relays")
+	}
+	return b, nil
+}
+
+type bunkerRequest struct {
+	ID     string   `json:"id"`
+	Method string   `json:"method"`
+	Params []string `json:"params"`
+}
+
+type bunkerResponse struct {
+	ID     string `json:"id"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// bunkerTransport carries kind 24133 events between us and the signer
+type bunkerTransport interface {
+	Publish(ctx context.Context, ev nostr.Event) error
+	// events addressed to the client key, closed when the connection ends
+	Events() <-chan *nostr.Event
+	Close()
+}
+
+type relayTransport struct {
+	relay *nostr.Relay
+	sub   *nostr.Subscription
+}
+
+func dialBunkerRelay(ctx context.Context, url string, clientPK string) (bunkerTransport, error) {
+	relay, err := nostr.RelayConnect(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for notice := range relay.Notices {
+			TheLog.Printf("bunker relay: %s notice: %s\n", url, notice)
+		}
+	}()
+	since := time.Now().Add(-time.Minute)
+	sub := relay.Subscribe(CTX, nostr.Filters{{
+		Kinds: []int{KindNostrConnect},
+		Tags:  nostr.TagMap{"p": []string{clientPK}},
+		Since: &since,
+	}})
+	// the only reader of the close error, the read loop is done once it
+	// arrives so the subscription and notices can be closed safely
+	go func() {
+		<-relay.ConnectionError
+		releaseRelay(relay, []*nostr.Subscription{sub})
+	}()
+	return &relayTransport{relay: relay, sub: sub}, nil
+}
+
+func (t *relayTransport) Publish(ctx context.Context, ev nostr.Event) error {
+	if t.relay.Publish(ctx, ev) == nostr.PublishStatusFailed {
+		return errors.New("relay refused the request")
+	}
+	return nil
+}
+
+func (t *relayTransport) Events() <-chan *nostr.Event {
+	return t.sub.Events
+}
+
+// ends the read loop, dialBunkerRelay's goroutine then closes Events
+func (t *relayTransport) Close() {
+	t.relay.Close()
+}
+
+// BunkerSigner signs events with a NIP-46 remote signer.  Only an ephemeral
+// client key is kept locally.
+type BunkerSigner struct {
+	uri      BunkerURI
+	clientSK string
+	clientPK string
+	secret   []byte // nip04 shared secret with the remote signer
+	// how to reach a relay, replaceable so it can run over anything
+	dial func(ctx context.Context, url string, clientPK string) (bunkerTransport, error)
+
+	mu        sync.Mutex
+	transport bunkerTransport
+	pending   map[string]*bunkerCall
+}
+
+type bunkerCall struct {
+	response  chan bunkerResponse
+	onAuthURL func(string)
+}
+
+func NewBunkerSigner(uri BunkerURI, clientSK string) (*BunkerSigner, error) {
+	clientPK, err := nostr.GetPublicKey(clientSK)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := nip04.ComputeSharedSecret(uri.Pubkey, clientSK)
+	if err != nil {
+		return nil, err
+	}
+	return &BunkerSigner{
+		uri:      uri,
+		clientSK: clientSK,
+		clientPK: clientPK,
+		secret:   secret,
+		dial:     dialBunkerRelay,
+		pending:  make(map[string]*bunkerCall),
+	}, nil
+}
+
+func (b *BunkerSigner) connected(ctx context.Context) (bunkerTransport, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.transport != nil {
+		return b.transport, nil
+	}
+	var lastErr error
+	for _, u := range b.uri.Relays {
+		t, err := b.dial(ctx, u, b.clientPK)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		b.transport = t
+		go b.read(t)
+		return t, nil
+	}
+	return nil, fmt.Errorf("no bunker relay reachable: %w", lastErr)
+}
+
+// deliver responses to their waiting requests
+func (b *BunkerSigner) read(t bunkerTransport) {
+	for ev := range t.Events() {
+		if ev.PubKey != b.uri.Pubkey || ev.Kind != KindNostrConnect {
+			continue
+		}
+		plain, err := nip04.Decrypt(ev.Content, b.secret)
+		if err != nil {
+			continue
+		}
+		var resp bunkerResponse
+		if json.Unmarshal([]byte(plain), &resp) != nil {
+			continue
+		}
+		b.mu.Lock()
+		call, found := b.pending[resp.ID]
+		b.mu.Unlock()
+		if !found {
+			continue
+		}
+		if resp.Result == "auth_url" {
+			// the signer wants the user to approve somewhere, keep waiting
+			if call.onAuthURL != nil {
+				call.onAuthURL(resp.Error)
+			}
+			continue
+		}
+		select {
+		case call.response <- resp:
+		default:
+		}
+	}
+
+	b.mu.Lock()
+	if b.transport == t {
+		b.transport = nil
+	}
+	for id, call := range b.pending {
+		select {
+		case call.response <- bunkerResponse{ID: id, Error: errBunkerClosed.Error()}:
+		default:
+		}
+	}
+	b.mu.Unlock()
+}
+
+func (b *BunkerSigner) request(ctx context.Context, method string, params []string, onAuthURL func(string)) (string, error) {
+	t, err := b.connected(ctx)
+	if err != nil {
+		return "", err
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	req := bunkerRequest{ID: hex.EncodeToString(id), Method: method, Params: params}
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	content, err := nip04.Encrypt(string(raw), b.secret)
+	if err != nil {
+		return "", err
+	}
+	ev := nostr.Event{
+		PubKey:    b.clientPK,
+		CreatedAt: time.Now(),
+		Kind:      KindNostrConnect,
+		Tags:      nostr.Tags{{"p", b.uri.Pubkey}},
+		Content:   content,
+	}
+	if err := ev.Sign(b.clientSK); err != nil {
+		return "", err
+	}
+
+	call := &bunkerCall{response: make(chan bunkerResponse, 1), onAuthURL: onAuthURL}
+	b.mu.Lock()
+	b.pending[req.ID] = call
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.pending, req.ID)
+		b.mu.Unlock()
+	}()
+
+	if err := t.Publish(ctx, ev); err != nil {
+		return "", err
+	}
+	select {
+	case resp := <-call.response:
+		if resp.Error != "" {
+			return "", fmt.Errorf("remote signer: %s", resp.Error)
+		}
+		return resp.Result, nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("remote signer did not answer %s: %w", method, ctx.Err())
+	}
+}
+
+// Connect introduces the client key to the signer and returns the pubkey
+// it signs for
+func (b *BunkerSigner) Connect(ctx context.Context, onAuthURL func(string)) (string, error) {
+	params := []string{b.uri.Pubkey}
+	if b.uri.Secret != "" {
+		params = append(params, b.uri.Secret)
+	}
+	if _, err := b.request(ctx, "connect", params, onAuthURL); err != nil {
+		return "", err
+	}
+	pk, err := b.request(ctx, "get_public_key", nil, onAuthURL)
+	if err != nil {
+		return "", err
+	}
+	if len(pk) != 64 || !isHex(pk) {
+		return "", fmt.Errorf("remote signer returned an invalid pubkey %q", pk)
+	}
+	return pk, nil
+}
+
+// SignEvent has the remote signer sign ev, and checks what comes back
+func (b *BunkerSigner) SignEvent(ctx context.Context, ev *nostr.Event, onAuthURL func(string)) error {
+	unsigned, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	result, err := b.request(ctx, "sign_event", []string{string(unsigned)}, onAuthURL)
+	if err != nil {
+		return err
+	}
+	var signed nostr.Event
+	if err := json.Unmarshal([]byte(result), &signed); err != nil {
+		return fmt.Errorf("remote signer returned a bad event: %w", err)
+	}
+	// the id covers pubkey, created_at, kind, tags and content
+	if want := ev.GetID(); signed.GetID() != want || signed.ID != want {
+		return errors.New("remote signer returned a different event")
+	}
+	if ok, err := signed.CheckSignature(); err != nil || !ok {
+		return errors.New("remote signer returned an invalid signature")
+	}
+	*ev = signed
+	return nil
+}
+
+func (b *BunkerSigner) Close() {
+	b.mu.Lock()
+	t := b.transport
+	b.transport = nil
+	b.mu.Unlock()
+	if t != nil {
+		t.Close()
+	}
+}
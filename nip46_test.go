@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+)
+
+// fakeBunker plays the remote signer side of the connection
+type fakeBunker struct {
+	t      *testing.T
+	sk, pk string
+	userSK string
+	// answers a request, returning no responses leaves it unanswered
+	handle func(req bunkerRequest) []bunkerResponse
+
+	mu         sync.Mutex
+	dials      int
+	transports []*fakeTransport
+}
+
+type fakeTransport struct {
+	bunker *fakeBunker
+	secret []byte
+
+	mu     sync.Mutex
+	closed bool
+	events chan *nostr.Event
+}
+
+func newFakeBunker(t *testing.T) *fakeBunker {
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	return &fakeBunker{t: t, sk: sk, pk: pk, userSK: nostr.GeneratePrivateKey()}
+}
+
+func (f *fakeBunker) dial(ctx context.Context, url string, clientPK string) (bunkerTransport, error) {
+	secret, err := nip04.ComputeSharedSecret(clientPK, f.sk)
+	if err != nil {
+		return nil, err
+	}
+	t := &fakeTransport{bunker: f, secret: secret, events: make(chan *nostr.Event, 16)}
+	f.mu.Lock()
+	f.dials++
+	f.transports = append(f.transports, t)
+	f.mu.Unlock()
+	return t, nil
+}
+
+func (f *fakeBunker) dialCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.dials
+}
+
+func (f *fakeBunker) current() *fakeTransport {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.transports[len(f.transports)-1]
+}
+
+func (f *fakeBunker) signer(t *testing.T) *BunkerSigner {
+	uri := BunkerURI{Pubkey: f.pk, Relays: []string{"wss://bunker.example.com"}, Secret: "s3cret"}
+	b, err := NewBunkerSigner(uri, nostr.GeneratePrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.dial = f.dial
+	t.Cleanup(b.Close)
+	return b
+}
+
+func (ft *fakeTransport) Publish(ctx context.Context, ev nostr.Event) error {
+	if ev.Kind != KindNostrConnect || ev.Tags.GetFirst([]string{"p", ft.bunker.pk}) == nil {
+		return errors.New("not addressed to the signer")
+	}
+	plain, err := nip04.Decrypt(ev.Content, ft.secret)
+	if err != nil {
+		return err
+	}
+	var req bunkerRequest
+	if err := json.Unmarshal([]byte(plain), &req); err != nil {
+		return err
+	}
+	for _, resp := range ft.bunker.handle(req) {
+		ft.send(ev.PubKey, resp)
+	}
+	return nil
+}
+
+func (ft *fakeTransport) send(clientPK string, resp bunkerResponse) {
+	ev, err := ft.bunker.response(clientPK, ft.secret, resp)
+	if err != nil {
+		ft.bunker.t.Error(err)
+		return
+	}
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if !ft.closed {
+		ft.events <- ev
+	}
+}
+
+// the signed event carrying resp to the client
+func (f *fakeBunker) response(clientPK string, secret []byte, resp bunkerResponse) (*nostr.Event, error) {
+	raw, _ := json.Marshal(resp)
+	content, err := nip04.Encrypt(string(raw), secret)
+	if err != nil {
+		return nil, err
+	}
+	ev := nostr.Event{
+		PubKey:    f.pk,
+		CreatedAt: time.Now(),
+		Kind:      KindNostrConnect,
+		Tags:      nostr.Tags{{"p", clientPK}},
+		Content:   content,
+	}
+	ev.Sign(f.sk)
+	return &ev, nil
+}
+
+func (ft *fakeTransport) Events() <-chan *nostr.Event {
+	return ft.events
+}
+
+func (ft *fakeTransport) Close() {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if !ft.closed {
+		ft.closed = true
+		close(ft.events)
+	}
+}
+
+// a signer that does what it is asked
+func (f *fakeBunker) obedient(req bunkerRequest) []bunkerResponse {
+	switch req.Method {
+	case "connect":
+		if len(req.Params) < 2 || req.Params[0] != f.pk || req.Params[1] != "s3cret" {
+			return []bunkerResponse{{ID: req.ID, Error: "bad connect params"}}
+		}
+		return []bunkerResponse{{ID: req.ID, Result: "ack"}}
+	case "get_public_key":
+		pk, _ := nostr.GetPublicKey(f.userSK)
+		return []bunkerResponse{{ID: req.ID, Result: pk}}
+	case "sign_event":
+		var ev nostr.Event
+		if err := json.Unmarshal([]byte(req.Params[0]), &ev); err != nil {
+			return []bunkerResponse{{ID: req.ID, Error: err.Error()}}
+		}
+		ev.Sign(f.userSK)
+		raw, _ := json.Marshal(ev)
+		return []bunkerResponse{{ID: req.ID, Result: string(raw)}}
+	}
+	return []bunkerResponse{{ID: req.ID, Error: "unknown method"}}
+}
+
+func testContext(t *testing.T, d time.Duration) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func unsignedNote(pubkey string) *nostr.Event {
+	return &nostr.Event{
+		PubKey:    pubkey,
+		CreatedAt: time.Unix(1700000000, 0),
+		Kind:      3,
+		Tags:      nostr.Tags{{"p", strings.Repeat("a", 64)}},
+		Content:   "",
+	}
+}
+
+func TestBunkerConnect(t *testing.T) {
+	f := newFakeBunker(t)
+	f.handle = f.obedient
+	b := f.signer(t)
+
+	pk, err := b.Connect(testContext(t, 5*time.Second), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := nostr.GetPublicKey(f.userSK); pk != want {
+		t.Fatalf("got pubkey %s, want %s", pk, want)
+	}
+	if f.dialCount() != 1 {
+		t.Fatalf("dialed %d times, want 1", f.dialCount())
+	}
+}
+
+func TestBunkerSignEvent(t *testing.T) {
+	f := newFakeBunker(t)
+	f.handle = f.obedient
+	b := f.signer(t)
+	userPK, _ := nostr.GetPublicKey(f.userSK)
+
+	ev := unsignedNote(userPK)
+	if err := b.SignEvent(testContext(t, 5*time.Second), ev, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := ev.CheckSignature(); err != nil || !ok {
+		t.Fatalf("event not signed: %v", err)
+	}
+	if ev.ID != ev.GetID() {
+		t.Fatal("event id does not match")
+	}
+}
+
+func TestBunkerSignEventRejectsChanges(t *testing.T) {
+	tamper := map[string]func(ev *nostr.Event){
+		"tags":       func(ev *nostr.Event) { ev.Tags = append(ev.Tags, nostr.Tag{"p", strings.Repeat("b", 64)}) },
+		"created_at": func(ev *nostr.Event) { ev.CreatedAt = ev.CreatedAt.Add(time.Hour) },
+		"kind":       func(ev *nostr.Event) { ev.Kind = 1 },
+		"content":    func(ev *nostr.Event) { ev.Content = "hi" },
+	}
+	for name, change := range tamper {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeBunker(t)
+			f.handle = func(req bunkerRequest) []bunkerResponse {
+				var ev nostr.Event
+				json.Unmarshal([]byte(req.Params[0]), &ev)
+				change(&ev)
+				ev.Sign(f.userSK)
+				raw, _ := json.Marshal(ev)
+				return []bunkerResponse{{ID: req.ID, Result: string(raw)}}
+			}
+			b := f.signer(t)
+			userPK, _ := nostr.GetPublicKey(f.userSK)
+
+			ev := unsignedNote(userPK)
+			if err := b.SignEvent(testContext(t, 5*time.Second), ev, nil); err == nil {
+				t.Fatal("accepted an event the signer changed")
+			}
+			if ev.Sig != "" {
+				t.Fatal("event was modified")
+			}
+		})
+	}
+}
+
+func TestBunkerSignEventBadSignature(t *testing.T) {
+	f := newFakeBunker(t)
+	f.handle = func(req bunkerRequest) []bunkerResponse {
+		var ev nostr.Event
+		json.Unmarshal([]byte(req.Params[0]), &ev)
+		ev.Sign(f.userSK)
+		ev.Sig = strings.Repeat("0", 128)
+		raw, _ := json.Marshal(ev)
+		return []bunkerResponse{{ID: req.ID, Result: string(raw)}}
+	}
+	b := f.signer(t)
+	userPK, _ := nostr.GetPublicKey(f.userSK)
+
+	if err := b.SignEvent(testContext(t, 5*time.Second), unsignedNote(userPK), nil); err == nil {
+		t.Fatal("accepted an invalid signature")
+	}
+}
+
+func TestBunkerAuthURL(t *testing.T) {
+	f := newFakeBunker(t)
+	f.handle = func(req bunkerRequest) []bunkerResponse {
+		return append([]bunkerResponse{{ID: req.ID, Result: "auth_url", Error: "https://signer.example.com/approve"}},
+			f.obedient(req)...)
+	}
+	b := f.signer(t)
+
+	var mu sync.Mutex
+	var urls []string
+	onAuthURL := func(u string) {
+		mu.Lock()
+		urls = append(urls, u)
+		mu.Unlock()
+	}
+	if _, err := b.Connect(testContext(t, 5*time.Second), onAuthURL); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// one for connect, one for get_public_key
+	if len(urls) != 2 || urls[0] != "https://signer.example.com/approve" {
+		t.Fatalf("got auth urls %q", urls)
+	}
+}
+
+func TestBunkerErrorResponse(t *testing.T) {
+	f := newFakeBunker(t)
+	f.handle = func(req bunkerRequest) []bunkerResponse {
+		return []bunkerResponse{{ID: req.ID, Error: "user rejected"}}
+	}
+	b := f.signer(t)
+
+	_, err := b.Connect(testContext(t, 5*time.Second), nil)
+	if err == nil || !strings.Contains(err.Error(), "user rejected") {
+		t.Fatalf("got %v, want the signer's error", err)
+	}
+}
+
+func TestBunkerTimeout(t *testing.T) {
+	f := newFakeBunker(t)
+	f.handle = func(req bunkerRequest) []bunkerResponse { return nil }
+	b := f.signer(t)
+
+	_, err := b.Connect(testContext(t, 100*time.Millisecond), nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pending) != 0 {
+		t.Fatalf("%d requests left pending", len(b.pending))
+	}
+}
+
+func TestBunkerReconnect(t *testing.T) {
+	f := newFakeBunker(t)
+	requests := make(chan bunkerRequest, 1)
+	f.handle = func(req bunkerRequest) []bunkerResponse {
+		requests <- req
+		return nil
+	}
+	b := f.signer(t)
+
+	// the connection drops while a request is waiting
+	errc := make(chan error, 1)
+	go func() {
+		_, err := b.request(testContext(t, 5*time.Second), "get_public_key", nil, nil)
+		errc <- err
+	}()
+	<-requests
+	f.current().Close()
+	if err := <-errc; err == nil || !strings.Contains(err.Error(), errBunkerClosed.Error()) {
+		t.Fatalf("got %v, want %v", err, errBunkerClosed)
+	}
+
+	// the next request dials again
+	f.handle = f.obedient
+	if _, err := b.request(testContext(t, 5*time.Second), "get_public_key", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if f.dialCount() != 2 {
+		t.Fatalf("dialed %d times, want 2", f.dialCount())
+	}
+}
+
+// fakeRelay is a websocket relay in front of a fakeBunker, for testing the
+// real relay transport
+type fakeRelay struct {
+	bunker *fakeBunker
+	srv    *httptest.Server
+
+	mu    sync.Mutex
+	dials int
+	conns []*websocket.Conn
+	gone  chan struct{}
+}
+
+func newFakeRelay(t *testing.T, bunker *fakeBunker) *fakeRelay {
+	if CTX == nil {
+		CTX = context.Background()
+	}
+	r := &fakeRelay{bunker: bunker, gone: make(chan struct{}, 8)}
+	r.srv = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.srv.Close)
+	return r
+}
+
+func (r *fakeRelay) url() string {
+	return "ws" + strings.TrimPrefix(r.srv.URL, "http")
+}
+
+func (r *fakeRelay) dialCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dials
+}
+
+// hang up on every client
+func (r *fakeRelay) drop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.conns {
+		c.Close()
+	}
+}
+
+func (r *fakeRelay) serve(w http.ResponseWriter, req *http.Request) {
+	upgrader := websocket.Upgrader{}
+	c, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	r.dials++
+	r.conns = append(r.conns, c)
+	r.mu.Unlock()
+	defer func() {
+		c.Close()
+		r.gone <- struct{}{}
+	}()
+
+	// the subscription waiting for signer responses
+	var subID string
+	for {
+		_, message, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg []json.RawMessage
+		if json.Unmarshal(message, &msg) != nil || len(msg) < 2 {
+			continue
+		}
+		var label string
+		json.Unmarshal(msg[0], &label)
+		switch label {
+		case "REQ":
+			var id string
+			var filter nostr.Filter
+			json.Unmarshal(msg[1], &id)
+			if len(msg) > 2 && json.Unmarshal(msg[2], &filter) == nil &&
+				len(filter.Kinds) == 1 && filter.Kinds[0] == KindNostrConnect {
+				subID = id
+			}
+		case "EVENT":
+			var ev nostr.Event
+			json.Unmarshal(msg[1], &ev)
+			c.WriteJSON([]interface{}{"OK", ev.ID, true, ""})
+			if ev.Kind != KindNostrConnect {
+				continue
+			}
+			secret, err := nip04.ComputeSharedSecret(ev.PubKey, r.bunker.sk)
+			if err != nil {
+				continue
+			}
+			plain, err := nip04.Decrypt(ev.Content, secret)
+			if err != nil {
+				continue
+			}
+			var call bunkerRequest
+			if json.Unmarshal([]byte(plain), &call) != nil {
+				continue
+			}
+			for _, resp := range r.bunker.handle(call) {
+				out, err := r.bunker.response(ev.PubKey, secret, resp)
+				if err != nil {
+					continue
+				}
+				c.WriteJSON([]interface{}{"EVENT", subID, out})
+			}
+		}
+	}
+}
+
+func (r *fakeRelay) signer(t *testing.T) *BunkerSigner {
+	uri := BunkerURI{Pubkey: r.bunker.pk, Relays: []string{r.url()}, Secret: "s3cret"}
+	b, err := NewBunkerSigner(uri, nostr.GeneratePrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(b.Close)
+	return b
+}
+
+// waits for a relay's notices to close
+func noticesClosed(relay *nostr.Relay) bool {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-relay.Notices:
+			if !ok {
+				return true
+			}
+		case <-timeout:
+			return false
+		}
+	}
+}
+
+// waits for a transport's events to close
+func eventsClosed(t bunkerTransport) bool {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-t.Events():
+			if !ok {
+				return true
+			}
+		case <-timeout:
+			return false
+		}
+	}
+}
+
+func TestBunkerRelayTransport(t *testing.T) {
+	f := newFakeBunker(t)
+	f.handle = f.obedient
+	r := newFakeRelay(t, f)
+	b := r.signer(t)
+
+	pk, err := b.Connect(testContext(t, 5*time.Second), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := nostr.GetPublicKey(f.userSK); pk != want {
+		t.Fatalf("got pubkey %s, want %s", pk, want)
+	}
+
+	b.mu.Lock()
+	rt := b.transport.(*relayTransport)
+	b.mu.Unlock()
+	b.Close()
+	select {
+	case <-r.gone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay connection still open")
+	}
+	if !eventsClosed(rt) {
+		t.Fatal("events not closed after Close")
+	}
+	if !noticesClosed(rt.relay) {
+		t.Fatal("notices not closed after Close")
+	}
+}
+
+func TestBunkerRelayDropped(t *testing.T) {
+	f := newFakeBunker(t)
+	requests := make(chan bunkerRequest, 1)
+	f.handle = func(req bunkerRequest) []bunkerResponse {
+		requests <- req
+		return nil
+	}
+	r := newFakeRelay(t, f)
+	b := r.signer(t)
+
+	// the relay hangs up while a request is waiting
+	errc := make(chan error, 1)
+	go func() {
+		_, err := b.request(testContext(t, 5*time.Second), "get_public_key", nil, nil)
+		errc <- err
+	}()
+	<-requests
+	b.mu.Lock()
+	rt := b.transport.(*relayTransport)
+	b.mu.Unlock()
+	r.drop()
+	if err := <-errc; err == nil || !strings.Contains(err.Error(), errBunkerClosed.Error()) {
+		t.Fatalf("got %v, want %v", err, errBunkerClosed)
+	}
+	if !noticesClosed(rt.relay) {
+		t.Fatal("notices not closed after the connection dropped")
+	}
+
+	// the next request dials again
+	f.handle = f.obedient
+	if _, err := b.request(testContext(t, 5*time.Second), "get_public_key", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if r.dialCount() != 2 {
+		t.Fatalf("dialed %d times, want 2", r.dialCount())
+	}
+}
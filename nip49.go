@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NIP-49 scrypt work factor, 2^ncryptsecLogN, tunable with NCRYPTSEC_LOG_N
+var ncryptsecLogN = envInt("NCRYPTSEC_LOG_N", 16)
+
+// scrypt needs 128 * 8 * 2^logN bytes, 2^22 is already 4GiB
+const ncryptsecMaxLogN = 22
+
+const ncryptsecVersion = 0x02
+
+// key security byte: we don't track whether the key was handled insecurely
+const ncryptsecKeySecurity = 0x02
+
+func ncryptsecKey(password string, salt []byte, logN int) ([]byte, error) {
+	if logN < 1 || logN > ncryptsecMaxLogN {
+		return nil, fmt.Errorf("unsupported ncryptsec work factor %d", logN)
+	}
+	return scrypt.Key([]byte(norm.NFKC.String(password)), salt, 1<<uint(logN), 8, 1, 32)
+}
+
+// EncryptNcryptsec protects a hex private key with its own password
+func EncryptNcryptsec(sk string, password string) (string, error) {
+	key, err := hex.DecodeString(sk)
+	if err != nil || len(key) != 32 {
+		return "", errors.New("private key must be 64 hex characters")
+	}
+	salt := make([]byte, 16)
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	symmetric, err := ncryptsecKey(password, salt, ncryptsecLogN)
+	if err != nil {
+		return "", err
+	}
+	aead, err := chacha20poly1305.NewX(symmetric)
+	if err != nil {
+		return "", err
+	}
+	ad := []byte{ncryptsecKeySecurity}
+	data := []byte{ncryptsecVersion, byte(ncryptsecLogN)}
+	data = append(data, salt...)
+	data = append(data, nonce...)
+	data = append(data, ad...)
+	data = aead.Seal(data, nonce, key, ad)
+	return bech32Encode("ncryptsec", data)
+}
+
+// DecryptNcryptsec returns the hex private key inside an ncryptsec
+func DecryptNcryptsec(ncryptsec string, password string) (string, error) {
+	hrp, data, err := bech32Decode(strings.TrimSpace(ncryptsec))
+	if err != nil {
+		return "", err
+	}
+	if hrp != "ncryptsec" {
+		return "", fmt.Errorf("not an ncryptsec: %s", hrp)
+	}
+	if len(data) != 2+16+24+1+48 || data[0] != ncryptsecVersion {
+		return "", errors.New("unsupported ncryptsec version")
+	}
+	logN := int(data[1])
+	salt := data[2:18]
+	nonce := data[18:42]
+	ad := data[42:43]
+	symmetric, err := ncryptsecKey(password, salt, logN)
+	if err != nil {
+		return "", err
+	}
+	aead, err := chacha20poly1305.NewX(symmetric)
+	if err != nil {
+		return "", err
+	}
+	key, err := aead.Open(nil, nonce, data[43:], ad)
+	if err != nil {
+		return "", errors.New("wrong password or corrupt ncryptsec")
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// the formats a private key can be imported in
+const (
+	KeyFormatHex       = "hex"
+	KeyFormatNsec      = "nsec"
+	KeyFormatNcryptsec = "ncryptsec"
+)
+
+func DetectKeyFormat(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case strings.HasPrefix(s, "ncryptsec1"):
+		return KeyFormatNcryptsec, nil
+	case strings.HasPrefix(s, "nsec1"):
+		return KeyFormatNsec, nil
+	case len(s) == 64 && isHex(s):
+		return KeyFormatHex, nil
+	}
+	return "", errors.New("not a hex, nsec or ncryptsec private key")
+}
+
+// ParsePrivateKey turns any supported format into a hex private key and its
+// pubkey, the password is only used for ncryptsec
+func ParsePrivateKey(s string, password string) (string, string, error) {
+	s = strings.TrimSpace(s)
+	format, err := DetectKeyFormat(s)
+	if err != nil {
+		return "", "", err
+	}
+	var sk string
+	switch format {
+	case KeyFormatNcryptsec:
+		sk, err = DecryptNcryptsec(s, password)
+		if err != nil {
+			return "", "", err
+		}
+	case KeyFormatNsec:
+		prefix, value, err := nip19.Decode(s)
+		if err != nil || prefix != "nsec" {
+			return "", "", errors.New("invalid nsec")
+		}
+		sk = value.(string)
+	default:
+		sk = strings.ToLower(s)
+	}
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil || len(pk) != 64 {
+		return "", "", errors.New("private key does not give a valid pubkey")
+	}
+	return sk, pk, nil
+}
+
+// bech32 without the 90 character limit, which an ncryptsec exceeds
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32Polymod(values []byte) uint32 {
+	gen := []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HrpExpand(hrp string) []byte {
+	var out []byte
+	for _, c := range hrp {
+		out = append(out, byte(c>>5))
+	}
+	out = append(out, 0)
+	for _, c := range hrp {
+		out = append(out, byte(c&31))
+	}
+	return out
+}
+
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	acc := 0
+	bits := uint(0)
+	maxv := (1 << to) - 1
+	var out []byte
+	for _, b := range data {
+		if int(b)>>from != 0 {
+			return nil, errors.New("invalid data")
+		}
+		acc = acc<<from | int(b)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return out, nil
+}
+
+func bech32Encode(hrp string, data []byte) (string, error) {
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	polymod := bech32Polymod(append(append(bech32HrpExpand(hrp), values...), 0, 0, 0, 0, 0, 0)) ^ 1
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range values {
+		sb.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return sb.String(), nil
+}
+
+func bech32Decode(s string) (string, []byte, error) {
+	s = strings.ToLower(s)
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, errors.New("invalid bech32 string")
+	}
+	hrp := s[:pos]
+	var values []byte
+	for _, c := range s[pos+1:] {
+		i := strings.IndexRune(bech32Charset, c)
+		if i < 0 {
+			return "", nil, errors.New("invalid bech32 character")
+		}
+		values = append(values, byte(i))
+	}
+	if bech32Polymod(append(bech32HrpExpand(hrp), values...)) != 1 {
+		return "", nil, errors.New("invalid bech32 checksum")
+	}
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
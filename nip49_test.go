@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// the test vector from NIP-49
+func TestDecryptNcryptsecSpecVector(t *testing.T) {
+	ncryptsec := "ncryptsec1qgg9947rlpvqu76pj5ecreduf9jxhselq2nae2kghhvd5g7dgjtcxfqtd67p9m0w57lspw8gsq6yphnm8623nsl8xn9j4jdzz84zm3frztj3z7s35vpzmqf6ksu8r89qk5z2zxfmu5gv8th8wclt0h4p"
+	sk, err := DecryptNcryptsec(ncryptsec, "nostr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "3501454135014541350145413501453fefb02227e449e57cf4d3a3ce05378683"; sk != want {
+		t.Fatalf("got %s, want %s", sk, want)
+	}
+	if _, err := DecryptNcryptsec(ncryptsec, "nostr2"); err == nil {
+		t.Fatal("decrypted with the wrong password")
+	}
+}
+
+func TestNcryptsecWorkFactorCapped(t *testing.T) {
+	hrp, data, err := bech32Decode("ncryptsec1qgg9947rlpvqu76pj5ecreduf9jxhselq2nae2kghhvd5g7dgjtcxfqtd67p9m0w57lspw8gsq6yphnm8623nsl8xn9j4jdzz84zm3frztj3z7s35vpzmqf6ksu8r89qk5z2zxfmu5gv8th8wclt0h4p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[1] = ncryptsecMaxLogN + 1
+	heavy, err := bech32Encode(hrp, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = DecryptNcryptsec(heavy, "nostr")
+	if err == nil || !strings.Contains(err.Error(), "work factor") {
+		t.Fatalf("got %v, want a work factor error", err)
+	}
+}
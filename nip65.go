@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"gorm.io/gorm"
+)
+
+const KindRelayList = 10002
+
+// ingest a NIP-65 relay list, replacing any older one we have for the pubkey
+func handleRelayList(db *gorm.DB, ev *nostr.Event) {
+	var person Metadata
+	notFoundError := db.First(&person, "pubkey_hex = ?", ev.PubKey).Error
+	if notFoundError != nil {
+		person = Metadata{
+			PubkeyHex:          ev.PubKey,
+			MetadataUpdatedAt:  time.Unix(0, 0),
+			RelayListUpdatedAt: ev.CreatedAt,
+		}
+		db.Omit("Follows", "Servers", "RelayList").Create(&person)
+	} else {
+		if person.RelayListUpdatedAt.After(ev.CreatedAt) || person.RelayListUpdatedAt.Equal(ev.CreatedAt) {
+			// already have this one or a newer one
+			return
+		}
+		db.Model(&person).Omit("updated_at").Update("relay_list_updated_at", ev.CreatedAt)
+	}
+
+	var entries []RelayListEntry
+	seen := make(map[string]bool)
+	for _, tag := range ev.Tags.GetAll([]string{"r"}) {
+		if len(tag) < 2 {
+			continue
+		}
+		url, err := normalizeRelayURL(tag[1])
+		if err != nil || seen[url] {
+			continue
+		}
+		seen[url] = true
+		entry := RelayListEntry{PubkeyHex: ev.PubKey, Url: url, Read: true, Write: true}
+		if len(tag) >= 3 {
+			if tag[2] == "read" {
+				entry.Write = false
+			} else if tag[2] == "write" {
+				entry.Read = false
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("pubkey_hex = ?", ev.PubKey).Delete(&RelayListEntry{}).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.Create(&entries).Error
+	})
+	if err != nil {
+		TheLog.Printf("error saving relay list for %s: %s", ev.PubKey, err)
+	}
+}
+
+func GetRelayList(db *gorm.DB, pubkey string) []RelayListEntry {
+	var entries []RelayListEntry
+	db.Order("id").Find(&entries, "pubkey_hex = ?", pubkey)
+	return entries
+}
+
+// build an unsigned kind 10002 event from the relay list entries
+func RelayListEvent(pubkey string, entries []RelayListEntry) nostr.Event {
+	var tags nostr.Tags
+	for _, e := range entries {
+		if e.Read && e.Write {
+			tags = append(tags, nostr.Tag{"r", e.Url})
+		} else if e.Read {
+			tags = append(tags, nostr.Tag{"r", e.Url, "read"})
+		} else if e.Write {
+			tags = append(tags, nostr.Tag{"r", e.Url, "write"})
+		}
+	}
+	return nostr.Event{
+		PubKey:    pubkey,
+		CreatedAt: time.Now(),
+		Kind:      KindRelayList,
+		Tags:      tags,
+		Content:   "",
+	}
+}
+
+// sign and publish our relay list to every connected relay, returns the
+// tracked publish id
+func PublishRelayList(db *gorm.DB, account Account) (string, error) {
+	ev := RelayListEvent(account.Pubkey, GetRelayList(db, account.Pubkey))
+	if err := Keys.Sign(account.Pubkey, &ev); err != nil {
+		return "", err
+	}
+
+	// mark it as ours already so an older copy from a relay doesn't replace the edits
+	db.Model(&Metadata{PubkeyHex: account.Pubkey}).Omit("updated_at").Update("relay_list_updated_at", ev.CreatedAt)
+
+	return QueueEvent(db, ev, fmt.Sprintf("relay list (%d relays)", len(ev.Tags))), nil
+}
+
+// add the relays from a relay list to our local relay statuses and have the
+// relay manager connect to them
+func SeedRelayStatuses(db *gorm.DB, entries []RelayListEntry) int {
+	added := 0
+	for _, e := range entries {
+		url, err := normalizeRelayURL(e.Url)
+		if err != nil {
+			continue
+		}
+		var rs RelayStatus
+		if db.First(&rs, "url = ?", url).Error == nil {
+			continue
+		}
+		if err := db.Create(&RelayStatus{Url: url, Status: "waiting"}).Error; err != nil {
+			TheLog.Printf("error seeding relay %s: %s", url, err)
+			continue
+		}
+		SendRelayCommand(RelayAdd, url)
+		added++
+	}
+	return added
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"gorm.io/gorm"
+)
+
+// NIP-51 mute list
+const KindMuteList = 10000
+
+var errOfflineKind = errors.New("only profile, contact list, mute list and relay list events can be imported")
+
+// ContactListEvent builds pubkey's contact list from the follows we know,
+// plus the pubkeys in add
+func ContactListEvent(db *gorm.DB, pubkey string, add []string) nostr.Event {
+	var me Metadata
+	if err := db.First(&me, "pubkey_hex = ?", pubkey).Error; err != nil {
+		TheLog.Printf("error getting metadata for account pubkey: %s", err)
+	}
+	var curFollows []Metadata
+	if err := db.Model(&me).Association("Follows").Find(&curFollows); err != nil {
+		TheLog.Printf("error getting follows for account: %s", err)
+	}
+
+	seen := make(map[string]bool)
+	var tags nostr.Tags
+	for _, follow := range curFollows {
+		if !seen[follow.PubkeyHex] {
+			seen[follow.PubkeyHex] = true
+			tags = append(tags, nostr.Tag{"p", follow.PubkeyHex})
+		}
+	}
+	for _, pk := range add {
+		if !seen[pk] {
+			seen[pk] = true
+			tags = append(tags, nostr.Tag{"p", pk})
+		}
+	}
+	return nostr.Event{
+		PubKey:    pubkey,
+		CreatedAt: time.Now(),
+		Kind:      nostr.KindContactList,
+		Tags:      tags,
+		Content:   "",
+	}
+}
+
+// MuteListEvent adds the pubkeys in add to pubkey's newest known mute list.
+// Its other tags and its private, encrypted content are kept as they are.
+// Without a known mute list it refuses, so one can't be wiped by accident.
+func MuteListEvent(db *gorm.DB, pubkey string, add []string) (nostr.Event, error) {
+	var me Metadata
+	if err := db.First(&me, "pubkey_hex = ?", pubkey).Error; err != nil || me.MuteList == "" {
+		return nostr.Event{}, errors.New("no mute list known for this account yet, sync it first")
+	}
+	var current nostr.Event
+	if err := json.Unmarshal([]byte(me.MuteList), &current); err != nil {
+		return nostr.Event{}, fmt.Errorf("stored mute list is unreadable: %w", err)
+	}
+
+	tags := current.Tags
+	for _, pk := range add {
+		if tags.GetFirst([]string{"p", pk}) == nil {
+			tags = append(tags, nostr.Tag{"p", pk})
+		}
+	}
+	if tags == nil {
+		tags = nostr.Tags{}
+	}
+	return nostr.Event{
+		PubKey:    pubkey,
+		CreatedAt: time.Now(),
+		Kind:      KindMuteList,
+		Tags:      tags,
+		Content:   current.Content,
+	}, nil
+}
+
+// ProfileEvent builds pubkey's kind 0 from the profile we know, as it was
+// published when we have that, so fields we don't keep survive
+func ProfileEvent(db *gorm.DB, pubkey string) (nostr.Event, error) {
+	var m Metadata
+	if err := db.First(&m, "pubkey_hex = ?", pubkey).Error; err != nil {
+		return nostr.Event{}, errors.New("no profile known for this account")
+	}
+	var published map[string]json.RawMessage
+	if m.MetadataContent != "" && json.Unmarshal([]byte(m.MetadataContent), &published) == nil {
+		return nostr.Event{
+			PubKey:    pubkey,
+			CreatedAt: time.Now(),
+			Kind:      nostr.KindSetMetadata,
+			Tags:      nostr.Tags{},
+			Content:   m.MetadataContent,
+		}, nil
+	}
+	profile := make(map[string]string)
+	for k, v := range map[string]string{
+		"name":         m.Name,
+		"display_name": m.DisplayName,
+		"about":        m.About,
+		"picture":      m.Picture,
+		"website":      m.Website,
+		"nip05":        m.Nip05,
+		"lud06":        m.Lud06,
+		"lud16":        m.Lud16,
+	} {
+		if v != "" {
+			profile[k] = v
+		}
+	}
+	content, err := json.Marshal(profile)
+	if err != nil {
+		return nostr.Event{}, err
+	}
+	return nostr.Event{
+		PubKey:    pubkey,
+		CreatedAt: time.Now(),
+		Kind:      nostr.KindSetMetadata,
+		Tags:      nostr.Tags{},
+		Content:   string(content),
+	}, nil
+}
+
+// UnsignedEventText is the unsigned event as one line of compact json,
+// short enough to paste or turn into a QR code
+func UnsignedEventText(ev nostr.Event) (string, error) {
+	ev.ID = ev.GetID()
+	ev.Sig = ""
+	raw, err := json.Marshal(ev)
+	return string(raw), err
+}
+
+// what the outbox calls an event built for offline signing
+func offlineDescription(ev nostr.Event) string {
+	switch ev.Kind {
+	case nostr.KindSetMetadata:
+		return "profile"
+	case nostr.KindContactList:
+		return fmt.Sprintf("contact list (%d follows)", len(ev.Tags))
+	case KindMuteList:
+		return fmt.Sprintf("mute list (%d muted)", len(ev.Tags))
+	case KindRelayList:
+		return fmt.Sprintf("relay list (%d relays)", len(ev.Tags))
+	}
+	return fmt.Sprintf("kind %d", ev.Kind)
+}
+
+// ImportSignedEvent takes an event signed elsewhere for a watch-only
+// account, checks it and queues it for publishing
+func ImportSignedEvent(db *gorm.DB, raw []byte) (nostr.Event, error) {
+	var ev nostr.Event
+	if err := json.Unmarshal(raw, &ev); err != nil {
+		return ev, fmt.Errorf("not an event: %w", err)
+	}
+	if ev.Sig == "" {
+		return ev, errors.New("the event is not signed")
+	}
+	if ev.ID != ev.GetID() {
+		return ev, errors.New("event id does not match its content")
+	}
+	if ok, err := ev.CheckSignature(); err != nil || !ok {
+		return ev, errors.New("invalid signature")
+	}
+
+	var account Account
+	if err := db.First(&account, "pubkey = ? and watch_only = ?", ev.PubKey, true).Error; err != nil {
+		return ev, errors.New("the event is not for a watch-only account")
+	}
+
+	// relays keep the newest replaceable event, an older one would be dropped
+	var m Metadata
+	var newest time.Time
+	switch ev.Kind {
+	case nostr.KindSetMetadata:
+		db.First(&m, "pubkey_hex = ?", ev.PubKey)
+		newest = m.MetadataUpdatedAt
+	case nostr.KindContactList:
+		db.First(&m, "pubkey_hex = ?", ev.PubKey)
+		newest = m.ContactsUpdatedAt
+	case KindRelayList:
+		db.First(&m, "pubkey_hex = ?", ev.PubKey)
+		newest = m.RelayListUpdatedAt
+	case KindMuteList:
+		db.First(&m, "pubkey_hex = ?", ev.PubKey)
+		newest = m.MuteListUpdatedAt
+	default:
+		return ev, errOfflineKind
+	}
+	if newest.After(ev.CreatedAt) {
+		return ev, fmt.Errorf("a newer event of this kind from %s is already known", newest.Format(time.RFC3339))
+	}
+
+	var queued int64
+	db.Model(&OutboxEvent{}).Where("id = ?", ev.ID).Count(&queued)
+	if queued > 0 {
+		return ev, errors.New("this event was already imported")
+	}
+
+	// show it locally right away, like it came back from a relay
+	ingestEvent(db, &ev)
+	QueueEvent(db, ev, offlineDescription(ev))
+	return ev, nil
+}
+
+// the account a headless command acts for: --account, or the active one
+func commandAccount(db *gorm.DB, npub string) (Account, error) {
+	var account Account
+	if npub == "" {
+		if err := db.First(&account, "active = ?", true).Error; err != nil {
+			return account, errors.New("no active account, pass --account")
+		}
+		return account, nil
+	}
+	pk, err := ParsePubkey(npub)
+	if err != nil {
+		return account, err
+	}
+	if err := db.First(&account, "pubkey = ?", pk).Error; err != nil {
+		return account, fmt.Errorf("no account for %s", npub)
+	}
+	return account, nil
+}
+
+func cmdUnsigned(db *gorm.DB, args []string) int {
+	flags := flag.NewFlagSet("unsigned", flag.ContinueOnError)
+	npub := flags.String("account", "", "npub of the account, defaults to the active one")
+	text := flags.Bool("text", false, "print one line of json instead of writing a file")
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: flightless unsigned contacts|mute|profile|relays [--account npub] [--text] [npub...]\n")
+		return 2
+	}
+	what := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	account, err := commandAccount(db, *npub)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	var pubkeys []string
+	for _, a := range flags.Args() {
+		pk, err := ParsePubkey(a)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", a, err)
+			return 2
+		}
+		pubkeys = append(pubkeys, pk)
+	}
+
+	var ev nostr.Event
+	switch what {
+	case "contacts":
+		ev = ContactListEvent(db, account.Pubkey, pubkeys)
+	case "mute":
+		ev, err = MuteListEvent(db, account.Pubkey, pubkeys)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+	case "profile":
+		ev, err = ProfileEvent(db, account.Pubkey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+	case "relays":
+		ev = RelayListEvent(account.Pubkey, GetRelayList(db, account.Pubkey))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown event %q, use contacts, mute, profile or relays\n", what)
+		return 2
+	}
+
+	if *text {
+		line, err := UnsignedEventText(ev)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		fmt.Println(line)
+		return 0
+	}
+	name, err := ExportUnsignedEvent(ev)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	fmt.Printf("unsigned %s written to %s\n", offlineDescription(ev), name)
+	return 0
+}
+
+// read a signed event from a file, or stdin for -
+func readSignedEvent(source string) ([]byte, error) {
+	if source == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(source)
+}
+
+func cmdImportSigned(db *gorm.DB, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: flightless import-signed <file|->\n")
+		return 2
+	}
+	raw, err := readSignedEvent(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	// the pool must be up before the event is queued, it publishes on connect
+	startHeadlessPool(db)
+	ev, err := ImportSignedEvent(db, []byte(strings.TrimSpace(string(raw))))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "not imported: %s\n", err)
+		return 1
+	}
+	fmt.Printf("imported %s %s, publishing...\n", offlineDescription(ev), ev.ID)
+	if !waitForOutbox(db, ev.ID, headlessPublishWait) {
+		fmt.Fprintf(os.Stderr, "not yet accepted by %d relays, it stays in the outbox and is retried on the next start\n", outboxMinAccepts)
+		return 1
+	}
+	fmt.Println("published")
+	return 0
+}
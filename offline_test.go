@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func signedEvent(t *testing.T, sk string, kind int, tags nostr.Tags, content string, at time.Time) *nostr.Event {
+	pk, _ := nostr.GetPublicKey(sk)
+	ev := &nostr.Event{PubKey: pk, CreatedAt: at, Kind: kind, Tags: tags, Content: content}
+	if err := ev.Sign(sk); err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+func TestMuteListEventMerges(t *testing.T) {
+	db := testDB(t)
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	muted := strings.Repeat("a", 64)
+	added := strings.Repeat("b", 64)
+
+	if _, err := MuteListEvent(db, pk, []string{added}); err == nil {
+		t.Fatal("built a mute list without knowing the current one")
+	}
+
+	db.Create(&Account{Pubkey: pk, WatchOnly: true})
+	tags := nostr.Tags{{"p", muted}, {"t", "spam"}}
+	handleEvent(db, signedEvent(t, sk, KindMuteList, tags, "encrypted?iv=x", time.Now().Add(-2*time.Hour)))
+	// an older one doesn't replace it
+	handleEvent(db, signedEvent(t, sk, KindMuteList, nil, "", time.Now().Add(-3*time.Hour)))
+
+	ev, err := MuteListEvent(db, pk, []string{added, muted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Content != "encrypted?iv=x" {
+		t.Fatalf("private content lost: %q", ev.Content)
+	}
+	want := nostr.Tags{{"p", muted}, {"t", "spam"}, {"p", added}}
+	if len(ev.Tags) != len(want) {
+		t.Fatalf("got tags %v, want %v", ev.Tags, want)
+	}
+	for i := range want {
+		if strings.Join(ev.Tags[i], ",") != strings.Join(want[i], ",") {
+			t.Fatalf("got tags %v, want %v", ev.Tags, want)
+		}
+	}
+}
+
+func TestProfileEventKeepsUnknownFields(t *testing.T) {
+	db := testDB(t)
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+
+	content := `{"name":"alice","banner":"https://example.com/b.png","bot":false}`
+	handleEvent(db, signedEvent(t, sk, 0, nostr.Tags{}, content, time.Now()))
+
+	ev, err := ProfileEvent(db, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var profile map[string]interface{}
+	if err := json.Unmarshal([]byte(ev.Content), &profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile["name"] != "alice" || profile["banner"] != "https://example.com/b.png" || profile["bot"] != false {
+		t.Fatalf("got profile %v", profile)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"gorm.io/gorm"
+)
+
+// how many relays must accept a queued event before it leaves the outbox,
+// override with OUTBOX_MIN_ACCEPTS
+var outboxMinAccepts = envInt("OUTBOX_MIN_ACCEPTS", 1)
+
+// serializes the read-modify-write of accepted relays
+var outboxMu sync.Mutex
+
+// QueueEvent stores a signed event in the outbox and publishes it to every
+// connected relay.  It stays queued until outboxMinAccepts relays accept it.
+func QueueEvent(db *gorm.DB, ev nostr.Event, description string) string {
+	raw, err := json.Marshal(ev)
+	if err != nil {
+		TheLog.Printf("error encoding event for outbox: %s", err)
+	} else {
+		err = db.Create(&OutboxEvent{
+			ID:          ev.ID,
+			Pubkey:      ev.PubKey,
+			Kind:        ev.Kind,
+			Description: description,
+			Raw:         string(raw),
+		}).Error
+		if err != nil {
+			TheLog.Printf("error saving event to outbox: %s", err)
+		}
+	}
+	Bus.Publish(BusMessage{Topic: TopicOutbox})
+	return Tracker.Publish(ev, description)
+}
+
+func (o OutboxEvent) Event() (nostr.Event, error) {
+	var ev nostr.Event
+	err := json.Unmarshal([]byte(o.Raw), &ev)
+	return ev, err
+}
+
+func (o OutboxEvent) AcceptedBy(url string) bool {
+	for _, u := range strings.Split(o.AcceptedRelays, " ") {
+		if u == url {
+			return true
+		}
+	}
+	return false
+}
+
+func PendingOutbox(db *gorm.DB) []OutboxEvent {
+	var pending []OutboxEvent
+	db.Order("created_at").Find(&pending, "confirmed_at is null")
+	return pending
+}
+
+// record that a relay accepted a queued event
+func MarkOutboxAccepted(db *gorm.DB, id string, url string) {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	var o OutboxEvent
+	if db.First(&o, "id = ?", id).Error != nil || o.AcceptedBy(url) {
+		return
+	}
+	accepted := strings.TrimSpace(o.AcceptedRelays + " " + url)
+	updates := map[string]interface{}{
+		"accepted_relays": accepted,
+		"accepted_count":  o.AcceptedCount + 1,
+	}
+	if o.AcceptedCount+1 >= outboxMinAccepts && o.ConfirmedAt == nil {
+		now := time.Now()
+		updates["confirmed_at"] = &now
+		TheLog.Printf("outbox: %s (%s) confirmed by %d relays", o.Description, o.ID, o.AcceptedCount+1)
+	}
+	db.Model(&o).Updates(updates)
+	Bus.Publish(BusMessage{Topic: TopicOutbox})
+}
+
+// publish every pending event to a relay that just connected
+func FlushOutbox(db *gorm.DB, url string, relay *nostr.Relay) {
+	for _, o := range PendingOutbox(db) {
+		if o.AcceptedBy(url) {
+			continue
+		}
+		ev, err := o.Event()
+		if err != nil {
+			TheLog.Printf("outbox: bad event %s: %s", o.ID, err)
+			continue
+		}
+		db.Model(&o).Update("attempts", o.Attempts+1)
+		Tracker.PublishTo(ev, o.Description, url, relay)
+	}
+	Bus.Publish(BusMessage{Topic: TopicOutbox})
+}
+
+// publish every pending event to every connected relay
+func RetryOutbox(db *gorm.DB) {
+	Pool.Each(func(url string, relay *nostr.Relay) {
+		FlushOutbox(db, url, relay)
+	})
+}
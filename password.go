@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var errWrongPassword = errors.New("wrong password")
+
+// bcrypt only looks at the first 72 bytes of a password
+const maxPasswordLen = 72
+
+// ChangePassword re-encrypts every account's private key with newPwd and
+// replaces the login hash, all in one transaction.  Nothing changes if the
+// old password is wrong or any key fails to decrypt.
+func ChangePassword(db *gorm.DB, oldPwd []byte, newPwd []byte) error {
+	if len(newPwd) == 0 {
+		return errors.New("new password is empty")
+	}
+	if len(newPwd) > maxPasswordLen {
+		return fmt.Errorf("new password is longer than %d bytes", maxPasswordLen)
+	}
+	if err := CheckPassword(db, oldPwd); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := reencryptAccounts(tx, oldPwd, newPwd, false); err != nil {
+			return err
+		}
+		hash, err := HashAndSalt(newPwd)
+		if err != nil {
+			return err
+		}
+		return tx.Exec("update logins set password_hash = ?", hash).Error
+	})
+}
+
+// CheckPassword compares pwd with the login hash
+func CheckPassword(db *gorm.DB, pwd []byte) error {
+	var login Login
+	if err := db.First(&login).Error; err != nil {
+		return fmt.Errorf("no login found: %w", err)
+	}
+	return ComparePasswords(login.PasswordHash, pwd)
+}
+
+// UpgradeKeyEncryption moves keys still in the old ciphertext format to the
+// current one, and rehashes the login if its bcrypt cost is below
+// bcryptCost.  Called after a successful login, returns the number of keys
+// upgraded.
+func UpgradeKeyEncryption(db *gorm.DB, pwd []byte) (int, error) {
+	var login Login
+	if err := db.First(&login).Error; err != nil {
+		return 0, err
+	}
+	upgraded := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		n, err := reencryptAccounts(tx, pwd, pwd, true)
+		if err != nil {
+			return err
+		}
+		upgraded = n
+		if cost, err := bcrypt.Cost([]byte(login.PasswordHash)); err == nil && cost < bcryptCost {
+			hash, err := HashAndSalt(pwd)
+			if err != nil {
+				return err
+			}
+			return tx.Exec("update logins set password_hash = ?", hash).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return upgraded, nil
+}
+
+// decrypt every account's key with oldPwd and store it encrypted with
+// newPwd, optionally only those in the old format
+func reencryptAccounts(tx *gorm.DB, oldPwd []byte, newPwd []byte, onlyLegacy bool) (int, error) {
+	var accounts []Account
+	if err := tx.Find(&accounts).Error; err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, account := range accounts {
+		if account.WatchOnly || (onlyLegacy && !isLegacyCiphertext(account.Privatekey)) {
+			continue
+		}
+		sk, err := decryptAccountKey(oldPwd, account)
+		if err != nil {
+			return 0, fmt.Errorf("account %s: %w", account.Pubkey, err)
+		}
+		// the encrypted key is part of the primary key, so update it in place
+		err = tx.Model(&Account{}).
+			Where("pubkey = ? and privatekey = ?", account.Pubkey, account.Privatekey).
+			Update("privatekey", Encrypt(string(newPwd), sk)).Error
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
+}
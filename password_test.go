@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestChangePasswordTooLong(t *testing.T) {
+	db := testDB(t)
+	if err := db.AutoMigrate(&Login{}); err != nil {
+		t.Fatal(err)
+	}
+	bcryptCost = 4
+	hash, err := HashAndSalt([]byte("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&Login{PasswordHash: hash})
+
+	if err := ChangePassword(db, []byte("old"), bytes.Repeat([]byte("x"), maxPasswordLen+1)); err == nil {
+		t.Fatal("accepted a password bcrypt would truncate")
+	}
+	if err := CheckPassword(db, []byte("old")); err != nil {
+		t.Fatalf("old password no longer works: %v", err)
+	}
+	if err := ChangePassword(db, []byte("old"), bytes.Repeat([]byte("x"), maxPasswordLen)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPassword(db, bytes.Repeat([]byte("x"), maxPasswordLen)); err != nil {
+		t.Fatalf("new password does not work: %v", err)
+	}
+}
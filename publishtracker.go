@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// how long a relay has to answer an EVENT with OK
+var publishTimeout = 10 * time.Second
+
+// how long results are kept after the last answer, the outbox has the rest
+var publishKeep = 30 * time.Minute
+
+type PublishState string
+
+const (
+	PublishPending  PublishState = "pending"
+	PublishAccepted PublishState = "accepted"
+	PublishRejected PublishState = "rejected"
+	PublishTimeout  PublishState = "timeout"
+)
+
+type PublishResult struct {
+	Relay     string
+	State     PublishState
+	Reason    string
+	UpdatedAt time.Time
+}
+
+// an outgoing event and how each relay answered it
+type TrackedPublish struct {
+	Event       nostr.Event
+	Description string
+	CreatedAt   time.Time
+	Results     map[string]*PublishResult
+}
+
+type PublishTracker struct {
+	mu        sync.Mutex
+	publishes map[string]*TrackedPublish
+	last      string
+	// called whenever a result changes, without the lock held
+	OnChange func(id string)
+	// called when a relay accepts an event
+	OnAccepted func(id string, url string)
+}
+
+var Tracker = NewPublishTracker()
+
+func NewPublishTracker() *PublishTracker {
+	return &PublishTracker{publishes: make(map[string]*TrackedPublish)}
+}
+
+// Publish sends a signed event to every connected relay, once each, and
+// tracks the answers
+func (t *PublishTracker) Publish(ev nostr.Event, description string) string {
+	tp := t.track(ev, description)
+	t.mu.Lock()
+	t.last = ev.ID
+	t.mu.Unlock()
+
+	Pool.Each(func(url string, r *nostr.Relay) {
+		t.publishTo(tp, url, r)
+	})
+	t.changed(ev.ID)
+	return ev.ID
+}
+
+// PublishTo sends a signed event to a single relay and tracks the answer
+func (t *PublishTracker) PublishTo(ev nostr.Event, description string, url string, r *nostr.Relay) {
+	tp := t.track(ev, description)
+	t.publishTo(tp, url, r)
+	t.changed(ev.ID)
+}
+
+func (t *PublishTracker) track(ev nostr.Event, description string) *TrackedPublish {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.evict()
+	tp, found := t.publishes[ev.ID]
+	if !found {
+		tp = &TrackedPublish{
+			Event:       ev,
+			Description: description,
+			CreatedAt:   time.Now(),
+			Results:     make(map[string]*PublishResult),
+		}
+		t.publishes[ev.ID] = tp
+	}
+	return tp
+}
+
+// forget publishes nothing has happened to for a while, except the last
+// one which the status view may be showing
+func (t *PublishTracker) evict() {
+	for id, tp := range t.publishes {
+		if id == t.last {
+			continue
+		}
+		latest := tp.CreatedAt
+		for _, res := range tp.Results {
+			if res.UpdatedAt.After(latest) {
+				latest = res.UpdatedAt
+			}
+		}
+		if time.Since(latest) > publishKeep {
+			delete(t.publishes, id)
+		}
+	}
+}
+
+// Retry publishes again to every connected relay that has not accepted the event
+func (t *PublishTracker) Retry(id string) {
+	t.mu.Lock()
+	tp, found := t.publishes[id]
+	t.mu.Unlock()
+	if !found {
+		return
+	}
+	Pool.Each(func(url string, r *nostr.Relay) {
+		t.mu.Lock()
+		res, tried := tp.Results[url]
+		skip := tried && (res.State == PublishAccepted || res.State == PublishPending)
+		t.mu.Unlock()
+		if !skip {
+			t.publishTo(tp, url, r)
+		}
+	})
+	t.changed(id)
+}
+
+func (t *PublishTracker) publishTo(tp *TrackedPublish, url string, r *nostr.Relay) {
+	t.set(tp, url, PublishPending, "")
+	go func() {
+		TheLog.Printf("publishing %s (%s) to %s\n", tp.Description, tp.Event.ID, url)
+		ctx, cancel := context.WithTimeout(CTX, publishTimeout)
+		defer cancel()
+		status := r.Publish(ctx, tp.Event)
+		TheLog.Printf("published %s to %s: %s\n", tp.Event.ID, url, status)
+		Metrics.Published(url, status == nostr.PublishStatusSucceeded)
+		switch status {
+		case nostr.PublishStatusSucceeded:
+			t.set(tp, url, PublishAccepted, "")
+			if t.OnAccepted != nil {
+				t.OnAccepted(tp.Event.ID, url)
+			}
+		case nostr.PublishStatusSent:
+			t.set(tp, url, PublishTimeout, "no OK before timeout")
+		default:
+			t.set(tp, url, PublishRejected, "")
+		}
+		t.changed(tp.Event.ID)
+	}()
+}
+
+func (t *PublishTracker) set(tp *TrackedPublish, url string, state PublishState, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res, found := tp.Results[url]
+	if !found {
+		res = &PublishResult{Relay: url}
+		tp.Results[url] = res
+	}
+	// keep a NOTICE that arrived while the publish was pending as the reason
+	if reason == "" && state == PublishRejected && res.Reason != "" {
+		reason = res.Reason
+	}
+	if state == PublishPending {
+		reason = ""
+	}
+	res.State = state
+	res.Reason = reason
+	res.UpdatedAt = time.Now()
+}
+
+// Notice records a relay NOTICE as the reason for the publish pending
+// there.  NOTICEs don't say which event they are about, so with more than
+// one pending it is not attached to any.
+func (t *PublishTracker) Notice(url string, notice string) {
+	var pending []string
+	t.mu.Lock()
+	for id, tp := range t.publishes {
+		if res, found := tp.Results[url]; found && res.State == PublishPending {
+			pending = append(pending, id)
+		}
+	}
+	if len(pending) != 1 {
+		t.mu.Unlock()
+		return
+	}
+	t.publishes[pending[0]].Results[url].Reason = notice
+	t.mu.Unlock()
+	t.changed(pending[0])
+}
+
+func (t *PublishTracker) changed(id string) {
+	if t.OnChange != nil {
+		t.OnChange(id)
+	}
+}
+
+// Last is the id of the most recent publish
+func (t *PublishTracker) Last() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.last
+}
+
+// Results is a copy of the per relay results for id, sorted by relay url
+func (t *PublishTracker) Results(id string) (TrackedPublish, []PublishResult, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tp, found := t.publishes[id]
+	if !found {
+		return TrackedPublish{}, nil, false
+	}
+	var results []PublishResult
+	for _, res := range tp.Results {
+		results = append(results, *res)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Relay < results[j].Relay })
+	return *tp, results, true
+}
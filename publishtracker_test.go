@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func trackedWith(tr *PublishTracker, id string, url string, state PublishState, at time.Time) {
+	tp := tr.track(nostr.Event{ID: id}, id)
+	tp.CreatedAt = at
+	tp.Results[url] = &PublishResult{Relay: url, State: state, UpdatedAt: at}
+}
+
+func TestPublishNoticeNeedsOnePending(t *testing.T) {
+	tr := NewPublishTracker()
+	url := "wss://relay.example.com"
+	trackedWith(tr, "a", url, PublishPending, time.Now())
+	trackedWith(tr, "b", url, PublishAccepted, time.Now())
+
+	tr.Notice(url, "rate limited")
+	if _, results, _ := tr.Results("a"); results[0].Reason != "rate limited" {
+		t.Fatalf("notice not attached to the only pending publish: %+v", results)
+	}
+
+	trackedWith(tr, "c", url, PublishPending, time.Now())
+	tr.Notice(url, "blocked")
+	for _, id := range []string{"a", "c"} {
+		if _, results, _ := tr.Results(id); results[0].Reason == "blocked" {
+			t.Fatalf("notice attached to %s with two pending", id)
+		}
+	}
+}
+
+func TestPublishTrackerEvicts(t *testing.T) {
+	tr := NewPublishTracker()
+	url := "wss://relay.example.com"
+	old := time.Now().Add(-2 * publishKeep)
+	trackedWith(tr, "old", url, PublishAccepted, old)
+	trackedWith(tr, "last", url, PublishAccepted, old)
+	tr.last = "last"
+	trackedWith(tr, "new", url, PublishAccepted, time.Now())
+
+	if _, _, found := tr.Results("old"); found {
+		t.Fatal("old publish was kept")
+	}
+	for _, id := range []string{"last", "new"} {
+		if _, _, found := tr.Results(id); !found {
+			t.Fatalf("%s publish was evicted", id)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// longest password we read from a file, fd or the environment
+const maxPasswordBytes = 4096
+
+// PasswordSource is where the master password comes from when it isn't
+// typed at the terminal, picked with --password-fd, --password-file or
+// --password-env
+type PasswordSource struct {
+	FD   int // -1 for none
+	File string
+	Env  string
+}
+
+var passwordSource = PasswordSource{FD: -1}
+
+func (s PasswordSource) Set() bool {
+	return s.FD >= 0 || s.File != "" || s.Env != ""
+}
+
+// check that at most one source was given
+func (s PasswordSource) Validate() error {
+	n := 0
+	if s.FD >= 0 {
+		n++
+	}
+	if s.File != "" {
+		n++
+	}
+	if s.Env != "" {
+		n++
+	}
+	if n > 1 {
+		return errors.New("use only one of --password-fd, --password-file and --password-env")
+	}
+	return nil
+}
+
+// Read the password.  A single trailing newline is dropped, an empty
+// password is an error.
+func (s PasswordSource) Read() ([]byte, error) {
+	var pwd []byte
+	var err error
+	switch {
+	case s.FD >= 0:
+		pwd, err = readPasswordFD(s.FD)
+	case s.File != "":
+		pwd, err = readPasswordFile(s.File)
+	case s.Env != "":
+		pwd, err = readPasswordEnv(s.Env)
+	default:
+		return nil, errors.New("no password source")
+	}
+	if err != nil {
+		return nil, err
+	}
+	pwd = bytes.TrimSuffix(pwd, []byte("\n"))
+	pwd = bytes.TrimSuffix(pwd, []byte("\r"))
+	if len(pwd) == 0 {
+		return nil, errors.New("the password is empty")
+	}
+	return pwd, nil
+}
+
+func readPasswordFD(fd int) ([]byte, error) {
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	if f == nil {
+		return nil, fmt.Errorf("--password-fd %d is not a valid file descriptor", fd)
+	}
+	defer f.Close()
+	pwd, err := readLimited(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading password from fd %d: %w", fd, err)
+	}
+	return pwd, nil
+}
+
+// the file must be a regular file owned by us that nobody else can read
+// or write
+func readPasswordFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("password file: %w", err)
+	}
+	defer f.Close()
+	// check the opened file, so it can't be swapped after the check
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("password file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("password file %s is not a regular file", path)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return nil, fmt.Errorf("password file %s is accessible by others (mode %04o), chmod 600 it", path, perm)
+	}
+	if uid, ok := fileOwner(info); ok && uid != os.Getuid() {
+		return nil, fmt.Errorf("password file %s is owned by uid %d, not by us (uid %d)", path, uid, os.Getuid())
+	}
+	pwd, err := readLimited(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading password file %s: %w", path, err)
+	}
+	return pwd, nil
+}
+
+// the variable is removed once read, so child processes don't inherit it
+func readPasswordEnv(name string) ([]byte, error) {
+	value, found := os.LookupEnv(name)
+	if !found {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+	os.Unsetenv(name)
+	return []byte(value), nil
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	pwd, err := io.ReadAll(io.LimitReader(r, maxPasswordBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(pwd) > maxPasswordBytes {
+		return nil, fmt.Errorf("longer than %d bytes", maxPasswordBytes)
+	}
+	return pwd, nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// no uid to compare on this platform
+func fileOwner(info os.FileInfo) (int, bool) {
+	return 0, false
+}
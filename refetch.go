@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/nbd-wtf/go-nostr"
+	"gorm.io/gorm"
+)
+
+// when each pubkey was last refetched on request, and whether it's running
+type refetchState struct {
+	started  time.Time
+	finished time.Time
+	events   int
+	relays   int
+}
+
+var refetches = make(map[string]*refetchState)
+var refetchesMu sync.Mutex
+
+// RefetchPubkey asks every connected relay, and the relays the pubkey
+// publishes to, for its latest profile, contact list and relay list.  The
+// events are ingested like any other.  Progress is published on the bus as
+// TopicRefetch, until all the relays have answered or timed out.
+func RefetchPubkey(db *gorm.DB, ctx context.Context, pubkey string) {
+	refetchesMu.Lock()
+	st, found := refetches[pubkey]
+	if found && st.finished.IsZero() {
+		// already running
+		refetchesMu.Unlock()
+		return
+	}
+	st = &refetchState{started: time.Now()}
+	refetches[pubkey] = st
+	refetchesMu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, outboxTimeout)
+		defer cancel()
+		filters := nostr.Filters{{
+			Kinds:   []int{0, 3, KindRelayList},
+			Authors: []string{pubkey},
+		}}
+
+		progress := func(update func(st *refetchState)) {
+			refetchesMu.Lock()
+			update(st)
+			refetchesMu.Unlock()
+			Bus.Publish(BusMessage{Topic: TopicRefetch, Pubkey: pubkey})
+		}
+
+		connected := Pool.URLs()
+		for pev := range Pool.SubscribeAll(ctx, filters) {
+			ingestEvent(db, pev.Event)
+			progress(func(st *refetchState) { st.events++ })
+		}
+		progress(func(st *refetchState) { st.relays += len(connected) })
+
+		// the relays they publish to that we are not connected to
+		var plan []OutboxPlan
+		isConnected := make(map[string]bool)
+		for _, u := range connected {
+			isConnected[u] = true
+		}
+		for _, u := range writeRelaysFor(db, pubkey) {
+			if !isConnected[u] {
+				plan = append(plan, OutboxPlan{Url: u, Authors: []string{pubkey}})
+			}
+		}
+		answered := FetchFromOutboxes(db, ctx, plan, func(OutboxPlan) {
+			progress(func(st *refetchState) { st.relays++ })
+		})
+
+		var events int
+		progress(func(st *refetchState) {
+			st.finished = time.Now()
+			events = st.events
+		})
+		TheLog.Printf("refetched %s: %d events from connected relays, %d/%d of their relays answered", pubkey, events, answered, len(plan))
+	}()
+}
+
+// a line for the details pane about the last refetch of pubkey
+func refetchStatus(pubkey string) string {
+	refetchesMu.Lock()
+	defer refetchesMu.Unlock()
+	st, found := refetches[pubkey]
+	if !found {
+		return ""
+	}
+	if st.finished.IsZero() {
+		return fmt.Sprintf("fetching latest... (%d seconds, %d events, %d relays answered)\n", int(time.Since(st.started).Seconds()), st.events, st.relays)
+	}
+	return fmt.Sprintf("fetched %d seconds ago (%d events from connected relays, %d relays answered)\n", int(time.Since(st.finished).Seconds()), st.events, st.relays)
+}
+
+// the metadata shown in the details pane
+func selectedMetadata(g *gocui.Gui) (Metadata, bool) {
+	v2, err := g.View("v2")
+	if err != nil {
+		return Metadata{}, false
+	}
+	_, cy := v2.Cursor()
+	if followSearch {
+		if len(followPages) > cy+CurrOffset {
+			return followPages[cy+CurrOffset], true
+		}
+	} else if len(v2Meta) > cy {
+		return v2Meta[cy], true
+	}
+	return Metadata{}, false
+}
+
+// fetch the latest profile, contacts and relay list for the selected person
+func refetchSelected(g *gocui.Gui, v *gocui.View) error {
+	m, ok := selectedMetadata(g)
+	if !ok {
+		return nil
+	}
+	RefetchPubkey(ViewDB, CTX, m.PubkeyHex)
+	return refreshV3(g, v)
+}
+
+// whether the details of pubkey show a refetch status that changes with time
+func hasRefetchStatus(pubkey string) bool {
+	refetchesMu.Lock()
+	defer refetchesMu.Unlock()
+	_, found := refetches[pubkey]
+	return found
+}
+
+// keep the refetch status in the details pane counting, once a second
+func tickRefetchStatus(g *gocui.Gui) {
+	go func() {
+		for range time.Tick(time.Second) {
+			refetchesMu.Lock()
+			fetched := len(refetches) > 0
+			refetchesMu.Unlock()
+			if !fetched {
+				continue
+			}
+			g.Update(func(g *gocui.Gui) error {
+				m, ok := selectedMetadata(g)
+				if !ok || !hasRefetchStatus(m.PubkeyHex) {
+					return nil
+				}
+				return refreshV3(g, nil)
+			})
+		}
+	}()
+}
+
+// reload the details pane if it is still showing pubkey
+func refreshDetails(g *gocui.Gui, pubkey string) error {
+	m, ok := selectedMetadata(g)
+	if !ok || m.PubkeyHex != pubkey {
+		return nil
+	}
+	var fresh Metadata
+	if err := ViewDB.First(&fresh, "pubkey_hex = ?", pubkey).Error; err != nil {
+		return nil
+	}
+	if followSearch {
+		v2, _ := g.View("v2")
+		_, cy := v2.Cursor()
+		followPages[cy+CurrOffset] = fresh
+	} else {
+		v2, _ := g.View("v2")
+		_, cy := v2.Cursor()
+		v2Meta[cy] = fresh
+	}
+	return refreshV3(g, nil)
+}
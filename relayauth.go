@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip42"
+	"gorm.io/gorm"
+)
+
+var errAuthDenied = errors.New("auth not allowed for relay")
+
+func relayAuthAllowed(db *gorm.DB, url string) bool {
+	var rs RelayStatus
+	if db.First(&rs, "url = ?", url).Error != nil {
+		return false
+	}
+	return rs.AllowAuth
+}
+
+// answer the relay's NIP-42 challenges until the connection is done
+func (p *RelayPool) answerChallenges(pr *poolRelay, relay *nostr.Relay, subs []*nostr.Subscription, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case challenge := <-relay.Challenges:
+			err := authenticate(p.db, p.ctx, pr.url, relay, challenge)
+			if err != nil {
+				TheLog.Printf("relay %s auth: %s\n", pr.url, err)
+				p.setState(pr, RelayAuthRequired)
+				UpdateOrCreateRelayStatus(p.db, pr.url, "auth-required")
+				continue
+			}
+			p.setState(pr, RelayAuthed)
+			UpdateOrCreateRelayStatus(p.db, pr.url, "authenticated")
+			// relays that refused our subscriptions before auth will take them now
+			for _, sub := range subs {
+				sub.Fire(p.ctx)
+			}
+			go FlushOutbox(p.db, pr.url, relay)
+		}
+	}
+}
+
+// sign a kind 22242 event for the challenge with the active account
+func authenticate(db *gorm.DB, ctx context.Context, url string, relay *nostr.Relay, challenge string) error {
+	if !relayAuthAllowed(db, url) {
+		return errAuthDenied
+	}
+	var account Account
+	if err := db.First(&account, "active = ?", true).Error; err != nil {
+		return fmt.Errorf("no active account to auth with: %w", err)
+	}
+
+	ev := nip42.CreateUnsignedAuthEvent(challenge, account.Pubkey, relay.URL)
+	if err := Keys.Sign(account.Pubkey, &ev); err != nil {
+		return fmt.Errorf("signing auth event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	status := relay.Auth(ctx, ev)
+	if status == nostr.PublishStatusFailed {
+		return errors.New("relay rejected auth")
+	}
+	// NIP-42 does not require an OK, so sent is as good as it gets
+	TheLog.Printf("relay %s auth as %s: %s\n", url, account.PubkeyNpub, status)
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"gorm.io/gorm"
+)
+
+var errNotWss = errors.New("relay url must be wss://")
+
+// discovered relays have to be wss://
+func discoverableRelayURL(raw string) (string, error) {
+	u, err := normalizeRelayURL(raw)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(u, "wss://") {
+		return "", errNotWss
+	}
+	return u, nil
+}
+
+// a relay url recommended by the people we follow
+type DiscoveredRelay struct {
+	Url          string
+	Recommenders int
+	LastSeen     time.Time
+}
+
+// DiscoverRelays ranks the recommended relay urls by how many of the
+// pubkey's follows recommend them, then by how recently.  Relays we already
+// have are left out.
+func DiscoverRelays(db *gorm.DB, pubkey string) []DiscoveredRelay {
+	var servers []RecommendServer
+	db.Where("recommended_by in (?)",
+		db.Table("metadata_follows").Select("follow_pubkey_hex").Where("metadata_pubkey_hex = ?", pubkey),
+	).Find(&servers)
+
+	var known []string
+	db.Model(&RelayStatus{}).Pluck("url", &known)
+	have := make(map[string]bool)
+	for _, k := range known {
+		if n, err := normalizeRelayURL(k); err == nil {
+			have[n] = true
+		}
+	}
+
+	recommenders := make(map[string]map[string]bool)
+	lastSeen := make(map[string]time.Time)
+	for _, s := range servers {
+		u, err := discoverableRelayURL(s.Url)
+		if err != nil || have[u] {
+			continue
+		}
+		if recommenders[u] == nil {
+			recommenders[u] = make(map[string]bool)
+		}
+		recommenders[u][s.RecommendedBy] = true
+		if s.UpdatedAt.After(lastSeen[u]) {
+			lastSeen[u] = s.UpdatedAt
+		}
+	}
+
+	var found []DiscoveredRelay
+	for u, by := range recommenders {
+		found = append(found, DiscoveredRelay{Url: u, Recommenders: len(by), LastSeen: lastSeen[u]})
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Recommenders != found[j].Recommenders {
+			return found[i].Recommenders > found[j].Recommenders
+		}
+		return found[i].LastSeen.After(found[j].LastSeen)
+	})
+	return found
+}
+
+// ProbeRelay checks that a relay accepts connections and fetches its NIP-11
+// document, without adding it to our relays
+func ProbeRelay(db *gorm.DB, ctx context.Context, url string) string {
+	info := "no NIP-11 info"
+	if doc, err := FetchRelayInfo(ctx, url); err == nil {
+		saved := UpdateOrCreateRelayInfo(db, url, doc)
+		info = fmt.Sprintf("%s (%s)", saved.Name, saved.Software)
+		if saved.RestrictedReads() {
+			info += " auth/payment required"
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	relay, err := nostr.RelayConnect(ctx, url)
+	if err != nil {
+		return fmt.Sprintf("❌ %s", info)
+	}
+	latency := time.Since(start)
+	closeRelay(relay, nil)
+	return fmt.Sprintf("✅ %dms %s", latency.Milliseconds(), info)
+}
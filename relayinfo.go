@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"gorm.io/gorm"
+)
+
+// how long a fetched NIP-11 document is trusted before fetching it again
+var relayInfoMaxAge = 24 * time.Hour
+
+// NIP-11 relay information document, including the limitation object
+// (go-nostr's nip11 package does not have it yet)
+type RelayInformationDocument struct {
+	Name          string          `json:"name"`
+	Description   string          `json:"description"`
+	PubKey        string          `json:"pubkey"`
+	Contact       string          `json:"contact"`
+	SupportedNIPs []int           `json:"supported_nips"`
+	Software      string          `json:"software"`
+	Version       string          `json:"version"`
+	Limitation    RelayLimitation `json:"limitation"`
+}
+
+type RelayLimitation struct {
+	MaxMessageLength int  `json:"max_message_length"`
+	MaxSubscriptions int  `json:"max_subscriptions"`
+	MaxFilters       int  `json:"max_filters"`
+	MaxLimit         int  `json:"max_limit"`
+	MaxSubidLength   int  `json:"max_subid_length"`
+	MaxEventTags     int  `json:"max_event_tags"`
+	MaxContentLength int  `json:"max_content_length"`
+	MinPowDifficulty int  `json:"min_pow_difficulty"`
+	AuthRequired     bool `json:"auth_required"`
+	PaymentRequired  bool `json:"payment_required"`
+}
+
+// relay information url is the websocket url with an http(s) scheme
+func relayInfoURL(url string) string {
+	if strings.HasPrefix(url, "wss://") {
+		return "https://" + strings.TrimPrefix(url, "wss://")
+	} else if strings.HasPrefix(url, "ws://") {
+		return "http://" + strings.TrimPrefix(url, "ws://")
+	}
+	return url
+}
+
+func FetchRelayInfo(ctx context.Context, url string) (*RelayInformationDocument, error) {
+	ctx, cancel := context.WithTimeout(ctx, 7*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", relayInfoURL(url), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/nostr+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("relay info for %s returned %s", url, resp.Status)
+	}
+
+	var doc RelayInformationDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("relay info for %s: %w", url, err)
+	}
+	return &doc, nil
+}
+
+func UpdateOrCreateRelayInfo(db *gorm.DB, url string, doc *RelayInformationDocument) RelayInfo {
+	var nips []string
+	for _, n := range doc.SupportedNIPs {
+		nips = append(nips, strconv.Itoa(n))
+	}
+	info := RelayInfo{
+		Url:              url,
+		Name:             doc.Name,
+		Description:      doc.Description,
+		Pubkey:           doc.PubKey,
+		Contact:          doc.Contact,
+		Software:         doc.Software,
+		Version:          doc.Version,
+		SupportedNips:    strings.Join(nips, ","),
+		MaxMessageLength: doc.Limitation.MaxMessageLength,
+		MaxSubscriptions: doc.Limitation.MaxSubscriptions,
+		MaxFilters:       doc.Limitation.MaxFilters,
+		MaxLimit:         doc.Limitation.MaxLimit,
+		MaxEventTags:     doc.Limitation.MaxEventTags,
+		MaxContentLength: doc.Limitation.MaxContentLength,
+		MinPowDifficulty: doc.Limitation.MinPowDifficulty,
+		AuthRequired:     doc.Limitation.AuthRequired,
+		PaymentRequired:  doc.Limitation.PaymentRequired,
+		FetchedAt:        time.Now(),
+	}
+	// Save so that zero values (auth_required false etc) overwrite old ones
+	if err := db.Save(&info).Error; err != nil {
+		TheLog.Printf("error saving relay info for %s: %s", url, err)
+	}
+	return info
+}
+
+// get the relay info from the db, fetching it if it is missing or stale
+func GetRelayInfo(db *gorm.DB, ctx context.Context, url string) (RelayInfo, bool) {
+	var info RelayInfo
+	notFound := db.First(&info, "url = ?", url).Error
+	if notFound == nil && time.Since(info.FetchedAt) < relayInfoMaxAge {
+		return info, true
+	}
+	doc, err := FetchRelayInfo(ctx, url)
+	if err != nil {
+		TheLog.Printf("failed fetching relay info for %s: %s", url, err)
+		// use the stale copy if we have one
+		return info, notFound == nil
+	}
+	return UpdateOrCreateRelayInfo(db, url, doc), true
+}
+
+func (info RelayInfo) SupportsNip(nip int) bool {
+	for _, n := range strings.Split(info.SupportedNips, ",") {
+		if n == strconv.Itoa(nip) {
+			return true
+		}
+	}
+	return false
+}
+
+// relays that will not serve reads to us without auth or payment
+func (info RelayInfo) RestrictedReads() bool {
+	return info.AuthRequired || info.PaymentRequired
+}
+
+// apply the relay's advertised limitations to our filters.  the filters are
+// split into groups that each fit into one subscription.
+func applyRelayLimits(filters nostr.Filters, info RelayInfo) []nostr.Filters {
+	limited := make(nostr.Filters, 0, len(filters))
+	for _, f := range filters {
+		if info.MaxLimit > 0 && f.Limit > info.MaxLimit {
+			f.Limit = info.MaxLimit
+		}
+		limited = append(limited, f)
+	}
+
+	if info.MaxFilters <= 0 || len(limited) <= info.MaxFilters {
+		return []nostr.Filters{limited}
+	}
+
+	var groups []nostr.Filters
+	for len(limited) > 0 {
+		n := info.MaxFilters
+		if n > len(limited) {
+			n = len(limited)
+		}
+		groups = append(groups, limited[:n])
+		limited = limited[n:]
+	}
+	if info.MaxSubscriptions > 0 && len(groups) > info.MaxSubscriptions {
+		TheLog.Printf("relay allows %d subscriptions, dropping %d filter groups", info.MaxSubscriptions, len(groups)-info.MaxSubscriptions)
+		groups = groups[:info.MaxSubscriptions]
+	}
+	return groups
+}
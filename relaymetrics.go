@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"gorm.io/gorm"
+)
+
+// how many event ids to remember for duplicate detection before starting over
+var metricsSeenMax = 200000
+
+// in memory counters for one relay, flushed into the hourly RelayMetric rows
+type relayCounters struct {
+	events        map[int]int
+	bytes         int64
+	duplicates    int
+	invalidSigs   int
+	connects      int
+	connectMs     int64
+	eoses         int
+	eoseMs        int64
+	publishOK     int
+	publishFailed int
+}
+
+type RelayMetrics struct {
+	mu       sync.Mutex
+	counters map[string]*relayCounters
+	seen     map[string]struct{}
+}
+
+var Metrics = NewRelayMetrics()
+
+func NewRelayMetrics() *RelayMetrics {
+	return &RelayMetrics{
+		counters: make(map[string]*relayCounters),
+		seen:     make(map[string]struct{}),
+	}
+}
+
+func (m *RelayMetrics) relay(url string) *relayCounters {
+	c, found := m.counters[url]
+	if !found {
+		c = &relayCounters{events: make(map[int]int)}
+		m.counters[url] = c
+	}
+	return c
+}
+
+// Event counts an event from a relay.  It returns false for duplicates,
+// which should not be ingested again.  Events with bad signatures never get
+// here, go-nostr drops them while reading; see InvalidSig.
+func (m *RelayMetrics) Event(url string, ev *nostr.Event) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.relay(url)
+	c.events[ev.Kind]++
+	c.bytes += int64(eventSize(ev))
+	if _, dup := m.seen[ev.ID]; dup {
+		c.duplicates++
+		return false
+	}
+	if len(m.seen) >= metricsSeenMax {
+		m.seen = make(map[string]struct{})
+	}
+	m.seen[ev.ID] = struct{}{}
+	return true
+}
+
+// roughly the size of the event as json, without encoding it
+func eventSize(ev *nostr.Event) int {
+	// field names, quotes, the timestamp and the kind
+	size := 90 + len(ev.ID) + len(ev.PubKey) + len(ev.Sig) + len(ev.Content)
+	for _, tag := range ev.Tags {
+		size += 2
+		for _, v := range tag {
+			size += len(v) + 3
+		}
+	}
+	return size
+}
+
+// InvalidSig counts an event the relay sent with a bad signature
+func (m *RelayMetrics) InvalidSig(url string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.relay(url).invalidSigs++
+}
+
+func (m *RelayMetrics) Connected(url string, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.relay(url)
+	c.connects++
+	c.connectMs += latency.Milliseconds()
+}
+
+func (m *RelayMetrics) EOSE(url string, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.relay(url)
+	c.eoses++
+	c.eoseMs += elapsed.Milliseconds()
+}
+
+func (m *RelayMetrics) Published(url string, accepted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.relay(url)
+	if accepted {
+		c.publishOK++
+	} else {
+		c.publishFailed++
+	}
+}
+
+// Flush adds the counters into this hour's RelayMetric rows and resets them
+func (m *RelayMetrics) Flush(db *gorm.DB) {
+	m.mu.Lock()
+	counters := m.counters
+	m.counters = make(map[string]*relayCounters)
+	m.mu.Unlock()
+
+	hour := time.Now().Truncate(time.Hour)
+	for url, c := range counters {
+		var rm RelayMetric
+		if db.First(&rm, "url = ? and hour = ?", url, hour).Error != nil {
+			rm = RelayMetric{Url: url, Hour: hour}
+		}
+		byKind := rm.KindCounts()
+		for kind, n := range c.events {
+			byKind[kind] += n
+			rm.Events += n
+		}
+		if b, err := json.Marshal(byKind); err == nil {
+			rm.EventsByKind = string(b)
+		}
+		rm.Bytes += c.bytes
+		rm.Duplicates += c.duplicates
+		rm.InvalidSigs += c.invalidSigs
+		rm.Connects += c.connects
+		rm.ConnectMs += c.connectMs
+		rm.Eoses += c.eoses
+		rm.EoseMs += c.eoseMs
+		rm.PublishOK += c.publishOK
+		rm.PublishFailed += c.publishFailed
+		if err := db.Save(&rm).Error; err != nil {
+			TheLog.Printf("error saving relay metrics for %s: %s", url, err)
+		}
+	}
+}
+
+// flush the counters once a minute
+func (m *RelayMetrics) Run(db *gorm.DB) {
+	for {
+		time.Sleep(1 * time.Minute)
+		m.Flush(db)
+	}
+}
+
+// Add folds another row's counters into this one
+func (rm *RelayMetric) Add(o RelayMetric) {
+	byKind := rm.KindCounts()
+	for kind, n := range o.KindCounts() {
+		byKind[kind] += n
+	}
+	if b, err := json.Marshal(byKind); err == nil {
+		rm.EventsByKind = string(b)
+	}
+	rm.Events += o.Events
+	rm.Bytes += o.Bytes
+	rm.Duplicates += o.Duplicates
+	rm.InvalidSigs += o.InvalidSigs
+	rm.Connects += o.Connects
+	rm.ConnectMs += o.ConnectMs
+	rm.Eoses += o.Eoses
+	rm.EoseMs += o.EoseMs
+	rm.PublishOK += o.PublishOK
+	rm.PublishFailed += o.PublishFailed
+}
+
+func (rm RelayMetric) KindCounts() map[int]int {
+	byKind := make(map[int]int)
+	if rm.EventsByKind != "" {
+		json.Unmarshal([]byte(rm.EventsByKind), &byKind)
+	}
+	return byKind
+}
+
+func avgMs(total int64, n int) string {
+	if n == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%dms", total/int64(n))
+}
+
+func percent(part int, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d%%", part*100/total)
+}
+
+func displayRelayMetricsAsText(db *gorm.DB, url string) string {
+	var hours []RelayMetric
+	db.Order("hour desc").Find(&hours, "url = ? and hour > ?", url, time.Now().Add(-24*time.Hour))
+	if len(hours) == 0 {
+		return "no metrics recorded in the last 24 hours\n"
+	}
+
+	var sum RelayMetric
+	byKind := make(map[int]int)
+	for _, h := range hours {
+		for kind, n := range h.KindCounts() {
+			byKind[kind] += n
+		}
+		sum.Events += h.Events
+		sum.Bytes += h.Bytes
+		sum.Duplicates += h.Duplicates
+		sum.InvalidSigs += h.InvalidSigs
+		sum.Connects += h.Connects
+		sum.ConnectMs += h.ConnectMs
+		sum.Eoses += h.Eoses
+		sum.EoseMs += h.EoseMs
+		sum.PublishOK += h.PublishOK
+		sum.PublishFailed += h.PublishFailed
+	}
+	var kinds []int
+	for kind := range byKind {
+		kinds = append(kinds, kind)
+	}
+	sort.Ints(kinds)
+	var kindText []string
+	for _, kind := range kinds {
+		kindText = append(kindText, strconv.Itoa(kind)+":"+strconv.Itoa(byKind[kind]))
+	}
+
+	x := fmt.Sprintf("last 24h:\nevents: %d (%s)\nbytes: %d, duplicates: %s, invalid signatures: %d\nconnects: %d, avg connect latency: %s, avg time to EOSE: %s\npublish success: %s (%d ok, %d failed)\n\nhourly connect latency / time to EOSE:\n",
+		sum.Events,
+		strings.Join(kindText, " "),
+		sum.Bytes,
+		percent(sum.Duplicates, sum.Events),
+		sum.InvalidSigs,
+		sum.Connects,
+		avgMs(sum.ConnectMs, sum.Connects),
+		avgMs(sum.EoseMs, sum.Eoses),
+		percent(sum.PublishOK, sum.PublishOK+sum.PublishFailed),
+		sum.PublishOK,
+		sum.PublishFailed,
+	)
+	for _, h := range hours {
+		x += fmt.Sprintf("%s  %6s / %6s  %d events\n", h.Hour.Local().Format("Jan 02 15:04"), avgMs(h.ConnectMs, h.Connects), avgMs(h.EoseMs, h.Eoses), h.Events)
+	}
+	return x
+}
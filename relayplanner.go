@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"gorm.io/gorm"
+)
+
+// caps for outbox model fetching, override with OUTBOX_MAX_RELAYS and
+// OUTBOX_MAX_CONNECTIONS
+var outboxMaxRelays = envInt("OUTBOX_MAX_RELAYS", 30)
+var outboxMaxConnections = envInt("OUTBOX_MAX_CONNECTIONS", 5)
+
+// how long a short lived outbox subscription waits for EOSE
+var outboxTimeout = 30 * time.Second
+
+func envInt(name string, def int) int {
+	if s, found := os.LookupEnv(name); found {
+		if i, err := strconv.Atoi(s); err == nil && i > 0 {
+			return i
+		}
+	}
+	return def
+}
+
+// a relay to query and the authors we expect to find there
+type OutboxPlan struct {
+	Url     string
+	Authors []string
+}
+
+// the relays a pubkey publishes to: their NIP-65 write relays, or the
+// relays recommended for them when they have no relay list
+func writeRelaysFor(db *gorm.DB, pubkey string) []string {
+	var urls []string
+	for _, e := range GetRelayList(db, pubkey) {
+		if e.Write {
+			urls = append(urls, e.Url)
+		}
+	}
+	if len(urls) == 0 {
+		var servers []RecommendServer
+		db.Find(&servers, "pubkey_hex = ?", pubkey)
+		for _, s := range servers {
+			urls = append(urls, s.Url)
+		}
+	}
+
+	var valid []string
+	seen := make(map[string]bool)
+	for _, u := range urls {
+		u, err := normalizeRelayURL(u)
+		if err != nil {
+			continue
+		}
+		if !seen[u] {
+			seen[u] = true
+			valid = append(valid, u)
+		}
+	}
+	return valid
+}
+
+// PlanOutboxRelays picks the smallest set of relays (greedy set cover) that
+// covers the write relays of every pubkey, skipping relays we are already
+// connected to.  Pubkeys with no known write relays are left out.
+func PlanOutboxRelays(db *gorm.DB, pubkeys []string, connected []string, maxRelays int) []OutboxPlan {
+	isConnected := make(map[string]bool)
+	for _, u := range connected {
+		if n, err := normalizeRelayURL(u); err == nil {
+			isConnected[n] = true
+		}
+	}
+
+	// relay url -> pubkeys that write there
+	relayAuthors := make(map[string][]string)
+	uncovered := make(map[string]bool)
+	for _, pk := range pubkeys {
+		relays := writeRelaysFor(db, pk)
+		alreadyCovered := false
+		for _, u := range relays {
+			if isConnected[u] {
+				alreadyCovered = true
+				break
+			}
+		}
+		if alreadyCovered || len(relays) == 0 {
+			continue
+		}
+		uncovered[pk] = true
+		for _, u := range relays {
+			relayAuthors[u] = append(relayAuthors[u], pk)
+		}
+	}
+
+	var plan []OutboxPlan
+	for len(uncovered) > 0 && len(plan) < maxRelays {
+		bestUrl := ""
+		var bestAuthors []string
+		// sort the urls so that ties are broken the same way every time
+		urls := make([]string, 0, len(relayAuthors))
+		for u := range relayAuthors {
+			urls = append(urls, u)
+		}
+		sort.Strings(urls)
+		for _, u := range urls {
+			var covers []string
+			for _, pk := range relayAuthors[u] {
+				if uncovered[pk] {
+					covers = append(covers, pk)
+				}
+			}
+			if len(covers) > len(bestAuthors) {
+				bestUrl = u
+				bestAuthors = covers
+			}
+		}
+		if bestUrl == "" {
+			break
+		}
+		for _, pk := range bestAuthors {
+			delete(uncovered, pk)
+		}
+		delete(relayAuthors, bestUrl)
+		plan = append(plan, OutboxPlan{Url: bestUrl, Authors: bestAuthors})
+	}
+	if len(uncovered) > 0 {
+		TheLog.Printf("outbox plan: %d pubkeys not covered (max %d relays)", len(uncovered), maxRelays)
+	}
+	return plan
+}
+
+// the pubkeys the active account follows
+func activeFollows(db *gorm.DB) []string {
+	var account Account
+	if err := db.First(&account, "active = ?", true).Error; err != nil {
+		return nil
+	}
+	var follows []string
+	db.Table("metadata_follows").Select("follow_pubkey_hex").Where("metadata_pubkey_hex = ?", account.Pubkey).Scan(&follows)
+	var valid []string
+	for _, f := range follows {
+		if isHex(f) {
+			valid = append(valid, f)
+		}
+	}
+	return valid
+}
+
+// FetchFromOutboxes opens short lived subscriptions to the planned relays,
+// at most outboxMaxConnections at a time, and ingests what they return.
+// answered, when not nil, is called as each relay finishes successfully.
+// It returns the number of relays that were queried successfully.
+func FetchFromOutboxes(db *gorm.DB, ctx context.Context, plan []OutboxPlan, answered func(OutboxPlan)) int {
+	sem := make(chan struct{}, outboxMaxConnections)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for _, p := range plan {
+		p := p
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if fetchFromOutbox(db, ctx, p) {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+				if answered != nil {
+					answered(p)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return succeeded
+}
+
+func fetchFromOutbox(db *gorm.DB, ctx context.Context, p OutboxPlan) bool {
+	info, foundInfo := GetRelayInfo(db, ctx, p.Url)
+	if foundInfo && info.RestrictedReads() {
+		return false
+	}
+	relay, err := dialRelay(ctx, p.Url)
+	if err != nil {
+		TheLog.Printf("outbox: failed connecting to %s: %s", p.Url, err)
+		return false
+	}
+	defer closeRelay(relay, nil)
+
+	// drain notices so the relay's read loop doesn't block, closeRelay ends this
+	go func() {
+		for notice := range relay.Notices {
+			TheLog.Printf("outbox relay: %s notice: %s\n", p.Url, notice)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, outboxTimeout)
+	defer cancel()
+
+	authors := p.Authors
+	if len(authors) >= 1000 {
+		authors = authors[:999]
+	}
+	filters := nostr.Filters{{
+		Kinds:   []int{0, 3, KindRelayList},
+		Authors: authors,
+	}}
+	if foundInfo {
+		filters = applyRelayLimits(filters, info)[0]
+	}
+	sub := relay.Subscribe(ctx, filters)
+	// unblock a pending event so the subscription can close
+	defer func() {
+		go func() {
+			for range sub.Events {
+			}
+		}()
+	}()
+	count := 0
+	for {
+		select {
+		case ev, ok := <-sub.Events:
+			if !ok {
+				TheLog.Printf("outbox: %s closed after %d events", p.Url, count)
+				return true
+			}
+			// duplicates of what the pool already has are dropped
+			if Metrics.Event(p.Url, ev) {
+				ingestEvent(db, ev)
+			}
+			count++
+		case <-sub.EndOfStoredEvents:
+			TheLog.Printf("outbox: %d events for %d authors from %s", count, len(p.Authors), p.Url)
+			return true
+		case <-ctx.Done():
+			TheLog.Printf("outbox: timed out on %s after %d events", p.Url, count)
+			return false
+		}
+	}
+}
+
+// plan and run an outbox fetch for everyone the active account follows
+func RunOutboxFetch(db *gorm.DB, ctx context.Context) (planned int, succeeded int) {
+	plan := PlanOutboxRelays(db, activeFollows(db), Pool.URLs(), outboxMaxRelays)
+	TheLog.Printf("outbox plan: %d relays", len(plan))
+	return len(plan), FetchFromOutboxes(db, ctx, plan, nil)
+}
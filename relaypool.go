@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"gorm.io/gorm"
+)
+
+var errRelaySkipped = errors.New("relay skipped")
+
+// reconnect backoff: doubles from relayRetryBase up to relayRetryMax, override
+// the max with RELAY_MAX_RETRY_SECONDS
+var relayRetryBase = 2 * time.Second
+var relayRetryMax = time.Duration(envInt("RELAY_MAX_RETRY_SECONDS", 600)) * time.Second
+
+type RelayState string
+
+const (
+	RelayConnecting   RelayState = "connecting"
+	RelayConnected    RelayState = "connected"
+	RelayEOSE         RelayState = "eose"
+	RelayBackoff      RelayState = "backoff"
+	RelayAuthRequired RelayState = "auth-required"
+	RelayAuthed       RelayState = "authenticated"
+	RelaySkipped      RelayState = "skipped"
+	RelayDisconnected RelayState = "disconnected"
+)
+
+// an event and the relay it came from
+type PoolEvent struct {
+	Event *nostr.Event
+	Relay string
+}
+
+// one supervised connection per relay url, reconnecting with backoff when it
+// drops
+type poolRelay struct {
+	url     string
+	relay   *nostr.Relay
+	subs    []*nostr.Subscription
+	state   RelayState
+	retries int
+	stop    chan struct{}
+}
+
+// RelayPool owns all relay connections, keyed by url
+type RelayPool struct {
+	db     *gorm.DB
+	ctx    context.Context
+	mu     sync.Mutex
+	relays map[string]*poolRelay
+	// events from every relay's main subscription
+	events chan PoolEvent
+	// add/remove/reconnect requests from the bus
+	commands chan BusMessage
+}
+
+func NewRelayPool(db *gorm.DB, ctx context.Context) *RelayPool {
+	p := &RelayPool{
+		db:       db,
+		ctx:      ctx,
+		relays:   make(map[string]*poolRelay),
+		events:   make(chan PoolEvent),
+		commands: make(chan BusMessage, 64),
+	}
+	go func() {
+		for pe := range p.events {
+			ingestEvent(db, pe.Event)
+		}
+	}()
+	Bus.Subscribe(TopicRelayCommand, func(m BusMessage) {
+		p.commands <- m
+	})
+	go p.runCommands()
+	return p
+}
+
+// every event from a relay goes through here, one at a time
+var ingestMu sync.Mutex
+
+func ingestEvent(db *gorm.DB, ev *nostr.Event) {
+	ingestMu.Lock()
+	defer ingestMu.Unlock()
+	handleEvent(db, ev)
+}
+
+// Add starts a supervised connection to url, unless one is already running
+func (p *RelayPool) Add(url string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, running := p.relays[url]; running {
+		return false
+	}
+	pr := &poolRelay{url: url, state: RelayConnecting, stop: make(chan struct{})}
+	p.relays[url] = pr
+	go p.supervise(pr)
+	return true
+}
+
+// Remove stops the supervisor for url and closes its connection
+func (p *RelayPool) Remove(url string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pr, running := p.relays[url]
+	if !running {
+		return false
+	}
+	delete(p.relays, url)
+	close(pr.stop)
+	return true
+}
+
+// Get returns the live connection for url, if it is connected
+func (p *RelayPool) Get(url string) (*nostr.Relay, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pr, found := p.relays[url]
+	if !found || pr.relay == nil {
+		return nil, false
+	}
+	return pr.relay, true
+}
+
+// Each calls fn for every connected relay.  fn is called without the pool
+// lock held, so it may block on the network.
+func (p *RelayPool) Each(fn func(url string, relay *nostr.Relay)) {
+	type connected struct {
+		url   string
+		relay *nostr.Relay
+	}
+	var snapshot []connected
+	p.mu.Lock()
+	for url, pr := range p.relays {
+		if pr.relay != nil {
+			snapshot = append(snapshot, connected{url, pr.relay})
+		}
+	}
+	p.mu.Unlock()
+	for _, c := range snapshot {
+		fn(c.url, c.relay)
+	}
+}
+
+// URLs of every connected relay
+func (p *RelayPool) URLs() []string {
+	var urls []string
+	p.Each(func(url string, relay *nostr.Relay) {
+		urls = append(urls, url)
+	})
+	return urls
+}
+
+func (p *RelayPool) State(url string) (RelayState, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pr, found := p.relays[url]
+	if !found {
+		return RelayDisconnected, 0
+	}
+	return pr.state, pr.retries
+}
+
+func (p *RelayPool) setState(pr *poolRelay, state RelayState) {
+	p.mu.Lock()
+	if pr.state != state {
+		TheLog.Printf("relay %s: %s -> %s\n", pr.url, pr.state, state)
+	}
+	pr.state = state
+	p.mu.Unlock()
+}
+
+func (p *RelayPool) setRelay(pr *poolRelay, relay *nostr.Relay, subs []*nostr.Subscription) {
+	p.mu.Lock()
+	pr.relay = relay
+	pr.subs = subs
+	p.mu.Unlock()
+}
+
+func (p *RelayPool) forget(pr *poolRelay) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.relays[pr.url] == pr {
+		delete(p.relays, pr.url)
+	}
+}
+
+// SubscribeAll sends filters to every connected relay and fans the events
+// in to one channel.  The channel is closed when every relay has sent EOSE
+// or ctx is done.
+func (p *RelayPool) SubscribeAll(ctx context.Context, filters nostr.Filters) <-chan PoolEvent {
+	out := make(chan PoolEvent)
+	var wg sync.WaitGroup
+	p.Each(func(url string, relay *nostr.Relay) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sub := relay.Subscribe(ctx, filters)
+			defer func() {
+				// unblock a pending event so the subscription can close
+				go func() {
+					for range sub.Events {
+					}
+				}()
+				sub.Unsub()
+			}()
+			for {
+				select {
+				case ev, ok := <-sub.Events:
+					if !ok {
+						return
+					}
+					select {
+					case out <- PoolEvent{Event: ev, Relay: url}:
+					case <-ctx.Done():
+						return
+					}
+				case <-sub.EndOfStoredEvents:
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	})
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// exponential backoff with jitter: somewhere between half and all of the
+// doubled interval
+func relayBackoff(retries int) time.Duration {
+	if retries > 20 {
+		retries = 20
+	}
+	d := relayRetryBase << uint(retries)
+	if d > relayRetryMax || d <= 0 {
+		d = relayRetryMax
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (p *RelayPool) supervise(pr *poolRelay) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	for {
+		p.setState(pr, RelayConnecting)
+		relay, subs, err := connectRelay(p.db, p.ctx, pr.url)
+		if errors.Is(err, errRelaySkipped) {
+			p.setState(pr, RelaySkipped)
+			p.forget(pr)
+			return
+		}
+		if err != nil {
+			UpdateOrCreateRelayStatus(p.db, pr.url, "connection error: "+err.Error())
+		} else {
+			p.mu.Lock()
+			pr.retries = 0
+			p.mu.Unlock()
+			UpdateRelayRetries(p.db, pr.url, 0)
+			p.setRelay(pr, relay, subs)
+			p.setState(pr, RelayConnected)
+			done := make(chan struct{})
+			p.forward(pr, subs, done)
+			go FlushOutbox(p.db, pr.url, relay)
+			go p.answerChallenges(pr, relay, subs, done)
+
+			select {
+			case cErr := <-relay.ConnectionError:
+				close(done)
+				TheLog.Printf("relay: %s connection error: %s\n", pr.url, cErr)
+				p.setRelay(pr, nil, nil)
+				releaseRelay(relay, subs)
+				UpdateOrCreateRelayStatus(p.db, pr.url, "connection error: "+cErr.Error())
+			case <-pr.stop:
+				close(done)
+				TheLog.Printf("closing relay %s\n", pr.url)
+				p.setState(pr, RelayDisconnected)
+				p.setRelay(pr, nil, nil)
+				closeRelay(relay, subs)
+				return
+			case <-sig:
+				close(done)
+				TheLog.Println("exiting gracefully")
+				p.setState(pr, RelayDisconnected)
+				p.setRelay(pr, nil, nil)
+				closeRelay(relay, subs)
+				UpdateOrCreateRelayStatus(p.db, pr.url, "connection error: app exit")
+				return
+			}
+		}
+
+		p.mu.Lock()
+		pr.retries++
+		retries := pr.retries
+		p.mu.Unlock()
+		p.setState(pr, RelayBackoff)
+		UpdateRelayRetries(p.db, pr.url, retries)
+		wait := relayBackoff(retries)
+		TheLog.Printf("reconnecting to %s in %s (retry %d)\n", pr.url, wait, retries)
+		UpdateOrCreateRelayStatus(p.db, pr.url, fmt.Sprintf("reconnecting in %s", wait.Round(time.Second)))
+		select {
+		case <-time.After(wait):
+		case <-pr.stop:
+			p.setState(pr, RelayDisconnected)
+			return
+		case <-sig:
+			return
+		}
+	}
+}
+
+// feed a connection's subscriptions into the pool's event channel
+func (p *RelayPool) forward(pr *poolRelay, subs []*nostr.Subscription, done chan struct{}) {
+	subscribed := time.Now()
+	for _, sub := range subs {
+		sub := sub
+		go func() {
+			select {
+			case <-sub.EndOfStoredEvents:
+			case <-done:
+				return
+			}
+			TheLog.Printf("got EOSE from %s\n", pr.url)
+			Metrics.EOSE(pr.url, time.Since(subscribed))
+			p.setState(pr, RelayEOSE)
+			UpdateOrCreateRelayStatus(p.db, pr.url, "EOSE")
+		}()
+
+		go func() {
+			for ev := range sub.Events {
+				// duplicates from other relays are counted and dropped here
+				if Metrics.Event(pr.url, ev) {
+					p.events <- PoolEvent{Event: ev, Relay: pr.url}
+				}
+			}
+		}()
+	}
+}
+
+// the relay manager: relays added, deleted or changed from the UI
+func (p *RelayPool) runCommands() {
+	for m := range p.commands {
+		switch m.Command {
+		case RelayAdd:
+			p.Add(m.Url)
+		case RelayRemove:
+			p.Remove(m.Url)
+			if err := p.db.Delete(&RelayStatus{}, "url = ?", m.Url).Error; err != nil {
+				TheLog.Println(err)
+			}
+			Bus.Publish(BusMessage{Topic: TopicRelayStatus, Url: m.Url})
+		case RelayReconnect:
+			p.Remove(m.Url)
+			UpdateOrCreateRelayStatus(p.db, m.Url, "waiting")
+			p.Add(m.Url)
+		}
+	}
+}
+
+func closeRelay(relay *nostr.Relay, subs []*nostr.Subscription) {
+	for _, sub := range subs {
+		sub.Unsub()
+	}
+	relay.Close()
+	// the read loop reports the close, nobody else is listening for it
+	go func() {
+		<-relay.ConnectionError
+		close(relay.Notices)
+	}()
+}
+
+// like closeRelay, for a relay whose read loop already reported its error
+func releaseRelay(relay *nostr.Relay, subs []*nostr.Subscription) {
+	for _, sub := range subs {
+		sub.Unsub()
+	}
+	relay.Close()
+	// nothing sends notices any more, let their reader finish
+	close(relay.Notices)
+}
@@ -5,9 +5,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"os"
-	"os/signal"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/nbd-wtf/go-nostr"
@@ -15,9 +13,6 @@ import (
 	"gorm.io/gorm"
 )
 
-var nostrSubs []*nostr.Subscription
-var nostrRelays []*nostr.Relay
-
 func isHex(s string) bool {
 	dst := make([]byte, hex.DecodedLen(len(s)))
 
@@ -28,14 +23,27 @@ func isHex(s string) bool {
 	return true
 }
 
-func doRelay(db *gorm.DB, ctx context.Context, url string) bool {
-	relay, err := nostr.RelayConnect(ctx, url)
+// connect to a relay and subscribe to everything we want from it.  the
+// relay pool takes care of the events and disconnects.
+func connectRelay(db *gorm.DB, ctx context.Context, url string) (*nostr.Relay, []*nostr.Subscription, error) {
+	info, foundInfo := GetRelayInfo(db, ctx, url)
+	if foundInfo && info.RestrictedReads() && !relayAuthAllowed(db, url) {
+		TheLog.Printf("relay %s requires auth or payment for reads, skipping", url)
+		if info.AuthRequired {
+			UpdateOrCreateRelayStatus(db, url, "auth-required")
+		} else {
+			UpdateOrCreateRelayStatus(db, url, "skipped: payment required")
+		}
+		return nil, nil, errRelaySkipped
+	}
+
+	connectStart := time.Now()
+	relay, err := dialRelay(ctx, url)
 	if err != nil {
-		TheLog.Printf("failed initial connection to relay: %s, %s; skipping relay", url, err)
-		UpdateOrCreateRelayStatus(db, url, "failed initial connection")
-		return false
+		TheLog.Printf("failed connection to relay: %s, %s", url, err)
+		return nil, nil, err
 	}
-	nostrRelays = append(nostrRelays, relay)
+	Metrics.Connected(url, time.Since(connectStart))
 
 	UpdateOrCreateRelayStatus(db, url, "connection established")
 
@@ -99,11 +107,11 @@ func doRelay(db *gorm.DB, ctx context.Context, url string) bool {
 
 		sinceDisco := rs.LastDisco
 		if sinceDisco.IsZero() {
-			sinceDisco = time.Now().Add(-72 * time.Hour)
+			sinceDisco = time.Now().Add(-syncLookback)
 		}
 		since := rs.LastEOSE
 		if since.IsZero() {
-			since = time.Now().Add(-73 * time.Hour)
+			since = time.Now().Add(-syncLookback - time.Hour)
 		}
 		if sinceDisco.After(since) {
 			since = sinceDisco
@@ -116,7 +124,7 @@ func doRelay(db *gorm.DB, ctx context.Context, url string) bool {
 				Authors: []string{pubkey},
 			},
 			{
-				Kinds:   []int{3},
+				Kinds:   []int{3, KindMuteList, KindRelayList},
 				Limit:   100,
 				Authors: []string{pubkey},
 			},
@@ -126,7 +134,7 @@ func doRelay(db *gorm.DB, ctx context.Context, url string) bool {
 				Since: &since,
 			},
 			{
-				Kinds: []int{3},
+				Kinds: []int{3, KindRelayList},
 				Limit: 10000,
 				Since: &since,
 			},
@@ -138,7 +146,7 @@ func doRelay(db *gorm.DB, ctx context.Context, url string) bool {
 				Since:   &since,
 			},
 			{
-				Kinds: []int{3},
+				Kinds: []int{3, KindRelayList},
 				//Limit: 1000,
 				//Limit:   len(allFollow),
 				Limit:   10000,
@@ -149,7 +157,7 @@ func doRelay(db *gorm.DB, ctx context.Context, url string) bool {
 	} else {
 		filters = []nostr.Filter{
 			{
-				Kinds: []int{0, 2, 3},
+				Kinds: []int{0, 2, 3, KindRelayList},
 				//Tags:  t,
 				// limit = 3, get the three most recent notes
 				Limit: 100,
@@ -157,217 +165,229 @@ func doRelay(db *gorm.DB, ctx context.Context, url string) bool {
 		}
 	}
 
-	// create a subscription and submit to relay
-	sub := relay.Subscribe(ctx, filters)
-	nostrSubs = append(nostrSubs, sub)
+	// use the relay's NIP-11 limitations, if it has published any
+	filterGroups := []nostr.Filters{filters}
+	if foundInfo {
+		filterGroups = applyRelayLimits(filters, info)
+	}
 
-	go func() {
-		<-sub.EndOfStoredEvents
-		TheLog.Printf("got EOSE from %s\n", relay.URL)
-		UpdateOrCreateRelayStatus(db, url, "EOSE")
-	}()
+	// create the subscription(s) and submit to relay
+	var subs []*nostr.Subscription
+	for _, group := range filterGroups {
+		subs = append(subs, relay.Subscribe(ctx, group))
+	}
 
-	c := make(chan os.Signal)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		<-c
-		TheLog.Println("exiting gracefully")
-		sub.Unsub()
-		relay.Close()
-
-		UpdateOrCreateRelayStatus(db, relay.URL, "connection error: app exit")
-		// give other relays time to close
-		time.Sleep(3 * time.Second)
-		//os.Exit(0)
+		for notice := range relay.Notices {
+			TheLog.Printf("relay: %s notice: %s\n", relay.URL, notice)
+			Tracker.Notice(url, notice)
+			if strings.HasPrefix(notice, "auth-required") && !relayAuthAllowed(db, url) {
+				UpdateOrCreateRelayStatus(db, url, "auth-required")
+			}
+		}
 	}()
+	return relay, subs, nil
+}
 
-	go func() {
-		for ev := range sub.Events {
-			//TheLog.Printf("got event kind %d from %s", ev.Kind, relay.URL)
-			if ev.Kind == 0 {
-				// Metadata
-				m := Metadata{}
-				err := json.Unmarshal([]byte(ev.Content), &m)
-				if err != nil {
-					TheLog.Println(err)
-				}
-				m.PubkeyHex = ev.PubKey
-				npub, errEncode := nip19.EncodePublicKey(ev.PubKey)
-				if errEncode == nil {
-					m.PubkeyNpub = npub
-				}
-				m.MetadataUpdatedAt = ev.CreatedAt
-				if len(m.Picture) > 65535 {
-					//TheLog.Println("too big a picture for profile, skipping" + ev.PubKey)
-					m.Picture = ""
-					//continue
-				}
-				// check timestamps
-				var checkMeta Metadata
-				notFoundErr := db.First(&checkMeta, "pubkey_hex = ?", m.PubkeyHex).Error
-				if notFoundErr != nil {
-					err := db.Save(&m).Error
-					if err != nil {
-						TheLog.Println(err)
-					}
-					TheLog.Printf("Created metadata for %s, %s\n", m.Name, m.Nip05)
-				} else {
-					if checkMeta.MetadataUpdatedAt.After(ev.CreatedAt) {
-						//TheLog.Println("skipping old metadata for " + ev.PubKey)
-						continue
-					} else {
-						rowsUpdated := db.Model(Metadata{}).Where("pubkey_hex = ?", m.PubkeyHex).Updates(&m).RowsAffected
-						if rowsUpdated > 0 {
-							TheLog.Printf("Updated metadata for %s, %s\n", m.Name, m.Nip05)
-						}
-					}
+// ingest an event received from any relay
+func handleEvent(db *gorm.DB, ev *nostr.Event) {
+	//TheLog.Printf("got event kind %d", ev.Kind)
+	defer Bus.Publish(BusMessage{Topic: TopicProfile, Pubkey: ev.PubKey, Kind: ev.Kind})
+	if ev.Kind == 0 {
+		// Metadata
+		m := Metadata{}
+		err := json.Unmarshal([]byte(ev.Content), &m)
+		if err != nil {
+			TheLog.Println(err)
+		}
+		m.PubkeyHex = ev.PubKey
+		npub, errEncode := nip19.EncodePublicKey(ev.PubKey)
+		if errEncode == nil {
+			m.PubkeyNpub = npub
+		}
+		m.MetadataUpdatedAt = ev.CreatedAt
+		m.MetadataContent = ev.Content
+		if len(m.Picture) > 65535 {
+			//TheLog.Println("too big a picture for profile, skipping" + ev.PubKey)
+			m.Picture = ""
+			//return
+		}
+		// check timestamps
+		var checkMeta Metadata
+		notFoundErr := db.First(&checkMeta, "pubkey_hex = ?", m.PubkeyHex).Error
+		if notFoundErr != nil {
+			err := db.Save(&m).Error
+			if err != nil {
+				TheLog.Println(err)
+			}
+			TheLog.Printf("Created metadata for %s, %s\n", m.Name, m.Nip05)
+		} else {
+			if checkMeta.MetadataUpdatedAt.After(ev.CreatedAt) {
+				//TheLog.Println("skipping old metadata for " + ev.PubKey)
+				return
+			} else {
+				rowsUpdated := db.Model(Metadata{}).Where("pubkey_hex = ?", m.PubkeyHex).Updates(&m).RowsAffected
+				if rowsUpdated > 0 {
+					TheLog.Printf("Updated metadata for %s, %s\n", m.Name, m.Nip05)
 				}
-			} else if ev.Kind == 2 {
-				// recommend relay
-				TheLog.Println("FOUND TYPE 2! for " + ev.PubKey + " with content " + ev.Content)
-				var server RecommendServer
-				notF := db.First(&server, "pubkey_hex = ? and recommended_by = ? and url = ?", ev.PubKey, ev.PubKey, ev.Content).Error
-				if notF == nil {
-					db.Model(&server).Update("url", ev.Content)
-				} else {
-					// add to recommended servers
-					cErr := db.Create(&RecommendServer{
-						PubkeyHex:     ev.PubKey,
-						Url:           ev.Content,
-						RecommendedBy: ev.PubKey,
-					}).Error
-					if cErr != nil {
-						TheLog.Printf("error updating for kind2: %s", cErr)
+			}
+		}
+	} else if ev.Kind == 2 {
+		// recommend relay
+		TheLog.Println("FOUND TYPE 2! for " + ev.PubKey + " with content " + ev.Content)
+		url, uErr := normalizeRelayURL(ev.Content)
+		if uErr != nil {
+			TheLog.Printf("skipping kind2 from %s: %s", ev.PubKey, uErr)
+			return
+		}
+		var server RecommendServer
+		notF := db.First(&server, "pubkey_hex = ? and recommended_by = ? and url = ?", ev.PubKey, ev.PubKey, url).Error
+		if notF == nil {
+			db.Model(&server).Update("url", url)
+		} else {
+			// add to recommended servers
+			cErr := db.Create(&RecommendServer{
+				PubkeyHex:     ev.PubKey,
+				Url:           url,
+				RecommendedBy: ev.PubKey,
+			}).Error
+			if cErr != nil {
+				TheLog.Printf("error updating for kind2: %s", cErr)
+			}
+			// race condition, try again w/update?
+			/*
+				if cErr != nil {
+					notF := db.First(&server, "pubkey_hex = ? and recommended_by = ?", ev.PubKey, ev.PubKey).Error
+					if notF == nil {
+						db.Model(&server).Update("url", ev.Content)
 					}
-					// race condition, try again w/update?
-					/*
-						if cErr != nil {
-							notF := db.First(&server, "pubkey_hex = ? and recommended_by = ?", ev.PubKey, ev.PubKey).Error
-							if notF == nil {
-								db.Model(&server).Update("url", ev.Content)
-							}
-						}*/
+				}*/
+		}
+	} else if ev.Kind == 3 {
+
+		// Contact List
+		pTags := []string{"p"}
+		allPTags := ev.Tags.GetAll(pTags)
+		var person Metadata
+		notFoundError := db.First(&person, "pubkey_hex = ?", ev.PubKey).Error
+		if notFoundError != nil {
+			//TheLog.Printf("Creating blank metadata for %s\n", ev.PubKey)
+			person = Metadata{
+				PubkeyHex:    ev.PubKey,
+				TotalFollows: len(allPTags),
+				// set time to january 1st 1970
+				MetadataUpdatedAt: time.Unix(0, 0),
+				ContactsUpdatedAt: ev.CreatedAt,
+			}
+			db.Create(&person)
+		} else {
+			if person.ContactsUpdatedAt.After(ev.CreatedAt) {
+				// double check the timestamp for this follow list, don't update if older than most recent
+				//TheLog.Printf("skipping old contact list for " + ev.PubKey)
+				return
+			} else {
+				db.Model(&person).Omit("updated_at").Update("total_follows", len(allPTags))
+				db.Model(&person).Omit("updated_at").Update("contacts_updated_at", ev.CreatedAt)
+				//TheLog.Printf("updating (%d) follows for %s: %s\n", len(allPTags), person.Name, person.PubkeyHex)
+			}
+		}
+
+		// purge followers that have been 'unfollowed'
+		var oldFollows []Metadata
+		db.Model(&person).Association("Follows").Find(&oldFollows)
+		for _, oldFollow := range oldFollows {
+			found := false
+			for _, n := range allPTags {
+				if n[1] == oldFollow.PubkeyHex {
+					found = true
 				}
-			} else if ev.Kind == 3 {
+			}
+			if !found {
+				db.Exec("delete from metadata_follows where metadata_pubkey_hex = ? and follow_pubkey_hex = ?", person.PubkeyHex, oldFollow.PubkeyHex)
+			}
+		}
 
-				// Contact List
-				pTags := []string{"p"}
-				allPTags := ev.Tags.GetAll(pTags)
-				var person Metadata
-				notFoundError := db.First(&person, "pubkey_hex = ?", ev.PubKey).Error
-				if notFoundError != nil {
-					//TheLog.Printf("Creating blank metadata for %s\n", ev.PubKey)
-					person = Metadata{
-						PubkeyHex:    ev.PubKey,
-						TotalFollows: len(allPTags),
-						// set time to january 1st 1970
-						MetadataUpdatedAt: time.Unix(0, 0),
-						ContactsUpdatedAt: ev.CreatedAt,
+		for _, c := range allPTags {
+			// if the pubkey fails the sanitization (is a hex value) skip it
+			if !sanitizePubkey(c[1]) {
+				TheLog.Println("skipping invalid pubkey from follow list: " + c[1])
+				continue
+			}
+			// the recommended relay for the follow, if it is a valid relay url
+			server := ""
+			if len(c) >= 3 {
+				server, _ = normalizeRelayURL(c[2])
+			}
+			var followPerson Metadata
+			notFoundFollow := db.First(&followPerson, "pubkey_hex = ?", c[1]).Error
+
+			if notFoundFollow != nil {
+				// follow user not found, need to create it
+				var newUser Metadata
+				// follow user recommend server suggestion if it exists
+				if server != "" {
+					newUser = Metadata{
+						PubkeyHex: c[1],
+						Servers:   []RecommendServer{{Url: server, RecommendedBy: person.PubkeyHex}},
 					}
-					db.Create(&person)
 				} else {
-					if person.ContactsUpdatedAt.After(ev.CreatedAt) {
-						// double check the timestamp for this follow list, don't update if older than most recent
-						//TheLog.Printf("skipping old contact list for " + ev.PubKey)
-						continue
-					} else {
-						db.Model(&person).Omit("updated_at").Update("total_follows", len(allPTags))
-						db.Model(&person).Omit("updated_at").Update("contacts_updated_at", ev.CreatedAt)
-						//TheLog.Printf("updating (%d) follows for %s: %s\n", len(allPTags), person.Name, person.PubkeyHex)
-					}
+					newUser = Metadata{PubkeyHex: c[1]}
 				}
-
-				// purge followers that have been 'unfollowed'
-				var oldFollows []Metadata
-				db.Model(&person).Association("Follows").Find(&oldFollows)
-				for _, oldFollow := range oldFollows {
-					found := false
-					for _, n := range allPTags {
-						if n[1] == oldFollow.PubkeyHex {
-							found = true
-						}
-					}
-					if !found {
-						db.Exec("delete from metadata_follows where metadata_pubkey_hex = ? and follow_pubkey_hex = ?", person.PubkeyHex, oldFollow.PubkeyHex)
-					}
+				createNewErr := db.Omit("Follows").Create(&newUser).Error
+				if createNewErr != nil {
+					TheLog.Println("Error creating user for follow: ", createNewErr)
 				}
-
-				for _, c := range allPTags {
-					// if the pubkey fails the sanitization (is a hex value) skip it
-					if !sanitizePubkey(c[1]) {
-						TheLog.Println("skipping invalid pubkey from follow list: " + c[1])
-						continue
-					}
-					var followPerson Metadata
-					notFoundFollow := db.First(&followPerson, "pubkey_hex = ?", c[1]).Error
-
-					if notFoundFollow != nil {
-						// follow user not found, need to create it
-						var newUser Metadata
-						// follow user recommend server suggestion if it exists
-						if len(c) >= 3 && c[2] != "" {
-							newUser = Metadata{
-								PubkeyHex: c[1],
-								Servers:   []RecommendServer{{Url: c[2], RecommendedBy: person.PubkeyHex}},
-							}
-						} else {
-							newUser = Metadata{PubkeyHex: c[1]}
-						}
-						createNewErr := db.Omit("Follows").Create(&newUser).Error
-						if createNewErr != nil {
-							TheLog.Println("Error creating user for follow: ", createNewErr)
-						}
-						// use gorm insert statement to update the join table
-						db.Exec("insert or ignore into metadata_follows (metadata_pubkey_hex, follow_pubkey_hex) values (?, ?)", person.PubkeyHex, newUser.PubkeyHex)
+				// use gorm insert statement to update the join table
+				db.Exec("insert or ignore into metadata_follows (metadata_pubkey_hex, follow_pubkey_hex) values (?, ?)", person.PubkeyHex, newUser.PubkeyHex)
+			} else {
+				// follow user found,
+				// update the follow user's recommend server suggestion
+				if server != "" {
+					var servers []RecommendServer
+					db.Find(&servers, "pubkey_hex = ? and url = ? and recommended_by = ?", followPerson.PubkeyHex, server, person.PubkeyHex)
+					if len(servers) > 0 {
+						// already recommended, update time fields?
 					} else {
-						// follow user found,
-						// update the follow user's recommend server suggestion
-						if len(c) >= 3 && c[2] != "" {
-							var servers []RecommendServer
-							db.Find(&servers, "pubkey_hex = ? and url = ? and recommended_by = ?", followPerson.PubkeyHex, c[2], person.PubkeyHex)
-							if len(servers) > 0 {
-								// already recommended, update time fields?
-							} else {
-								// add to recommended servers
-								db.Model(&followPerson).Association("Servers").Append(&RecommendServer{
-									Url:           c[2],
-									RecommendedBy: person.PubkeyHex,
-								})
-							}
-						}
-						// use gorm insert statement to update the join table
-						db.Exec("insert or ignore into metadata_follows (metadata_pubkey_hex, follow_pubkey_hex) values (?, ?)", person.PubkeyHex, followPerson.PubkeyHex)
+						// add to recommended servers
+						db.Model(&followPerson).Association("Servers").Append(&RecommendServer{
+							Url:           server,
+							RecommendedBy: person.PubkeyHex,
+						})
 					}
 				}
+				// use gorm insert statement to update the join table
+				db.Exec("insert or ignore into metadata_follows (metadata_pubkey_hex, follow_pubkey_hex) values (?, ?)", person.PubkeyHex, followPerson.PubkeyHex)
 			}
 		}
-	}()
-
-	go func() {
-		for notice := range relay.Notices {
-			TheLog.Printf("relay: %s notice: %s\n", relay.URL, notice)
-		}
-	}()
+	} else if ev.Kind == KindRelayList {
+		handleRelayList(db, ev)
+	} else if ev.Kind == KindMuteList {
+		handleMuteList(db, ev)
+	}
+}
 
-	go func() {
-		for cErr := range relay.ConnectionError {
-			if cErr != nil {
-				var relayStatus RelayStatus
-				err := db.First(&relayStatus, "url = ?", relay.URL)
-				// if we don't find the relay in our statuses, don't reconnect
-				if err == nil {
-					TheLog.Printf("relay: %s connection error: %s\n", relay.URL, cErr)
-					UpdateOrCreateRelayStatus(db, relay.URL, "connection error: "+cErr.Error())
-					// attempt a re-connection
-					time.Sleep(60 * time.Second)
-					TheLog.Printf("reconnecting to %s\n", relay.URL)
-					UpdateOrCreateRelayStatus(db, relay.URL, "reconnecting")
-					doRelay(db, ctx, relay.URL)
-				}
-			}
-		}
-	}()
-	return true
+// keep the newest mute list of our accounts, so it can be added to without
+// losing what we don't understand (like its private, encrypted part)
+func handleMuteList(db *gorm.DB, ev *nostr.Event) {
+	var account Account
+	if db.First(&account, "pubkey = ?", ev.PubKey).Error != nil {
+		return
+	}
+	var person Metadata
+	if db.First(&person, "pubkey_hex = ?", ev.PubKey).Error != nil {
+		person = Metadata{PubkeyHex: ev.PubKey, MetadataUpdatedAt: time.Unix(0, 0)}
+		db.Create(&person)
+	} else if person.MuteListUpdatedAt.After(ev.CreatedAt) {
+		return
+	}
+	raw, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	db.Model(&person).Omit("updated_at").Updates(map[string]interface{}{
+		"mute_list":            string(raw),
+		"mute_list_updated_at": ev.CreatedAt,
+	})
 }
 
 func sanitizePubkey(s string) bool {
@@ -388,4 +408,10 @@ func UpdateOrCreateRelayStatus(db *gorm.DB, url string, status string) {
 	if rowsUpdated == 0 {
 		db.Create(&r)
 	}
+	Bus.Publish(BusMessage{Topic: TopicRelayStatus, Url: url})
+}
+
+func UpdateRelayRetries(db *gorm.DB, url string, retries int) {
+	db.Model(&RelayStatus{}).Where("url = ?", url).Update("retries", retries)
+	Bus.Publish(BusMessage{Topic: TopicRelayStatus, Url: url})
 }
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"gorm.io/gorm"
+)
+
+// normalizeRelayURL is the one place relay urls get cleaned up before they
+// are stored: whitespace trimmed, wss:// added when there is no scheme, host
+// lowercased, default port and trailing slash dropped.  Anything that is not
+// a ws:// or wss:// url with a host is rejected.
+func normalizeRelayURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", errors.New("empty relay url")
+	}
+	// NormalizeURL only knows lowercase schemes
+	if i := strings.Index(raw, "://"); i >= 0 {
+		raw = strings.ToLower(raw[:i]) + raw[i:]
+	}
+	u, err := url.Parse(nostr.NormalizeURL(raw))
+	if err != nil || u == nil {
+		return "", fmt.Errorf("invalid relay url %q", raw)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "wss" && u.Scheme != "ws" {
+		return "", fmt.Errorf("invalid relay scheme in %q", raw)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid relay url %q", raw)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if host == "" || strings.ContainsAny(host, " \t\r\n") {
+		return "", fmt.Errorf("invalid relay host in %q", raw)
+	}
+	if net.ParseIP(host) == nil && !strings.Contains(host, ".") && host != "localhost" {
+		return "", fmt.Errorf("invalid relay host in %q", raw)
+	}
+	if (u.Scheme == "wss" && port == "443") || (u.Scheme == "ws" && port == "80") {
+		port = ""
+	}
+	u.Host = host
+	if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	}
+	if port != "" {
+		u.Host += ":" + port
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// MergeRelayUrls normalizes the relay urls already stored, merging rows that
+// turn out to be the same relay and dropping ones that are not relay urls.
+// It runs once, as the "normalize relay urls" migration.
+func MergeRelayUrls(tx *gorm.DB) error {
+	var statuses []RelayStatus
+	if err := tx.Order("updated_at desc").Find(&statuses).Error; err != nil {
+		return err
+	}
+	// the most recently updated duplicate wins
+	latest := make(map[string]RelayStatus)
+	for _, rs := range statuses {
+		norm, err := normalizeRelayURL(rs.Url)
+		if err != nil {
+			TheLog.Printf("dropping invalid relay %q", rs.Url)
+			continue
+		}
+		if _, found := latest[norm]; !found {
+			latest[norm] = rs
+		}
+	}
+	for _, rs := range statuses {
+		norm, err := normalizeRelayURL(rs.Url)
+		if err == nil && norm == rs.Url && latest[norm].Url == rs.Url {
+			continue
+		}
+		if err := tx.Delete(&RelayStatus{}, "url = ?", rs.Url).Error; err != nil {
+			return err
+		}
+	}
+	for norm, rs := range latest {
+		if norm == rs.Url {
+			continue
+		}
+		rs.Url = norm
+		if err := tx.Create(&rs).Error; err != nil {
+			return err
+		}
+	}
+
+	var infos []RelayInfo
+	if err := tx.Order("fetched_at desc").Find(&infos).Error; err != nil {
+		return err
+	}
+	// the most recently fetched document wins
+	newest := make(map[string]RelayInfo)
+	for _, info := range infos {
+		norm, err := normalizeRelayURL(info.Url)
+		if _, found := newest[norm]; err == nil && !found {
+			newest[norm] = info
+		}
+	}
+	for _, info := range infos {
+		norm, err := normalizeRelayURL(info.Url)
+		if err == nil && norm == info.Url && newest[norm].Url == info.Url {
+			continue
+		}
+		if err := tx.Delete(&RelayInfo{}, "url = ?", info.Url).Error; err != nil {
+			return err
+		}
+	}
+	for norm, info := range newest {
+		if norm == info.Url {
+			continue
+		}
+		info.Url = norm
+		if err := tx.Create(&info).Error; err != nil {
+			return err
+		}
+	}
+
+	var metrics []RelayMetric
+	if err := tx.Find(&metrics).Error; err != nil {
+		return err
+	}
+	for _, rm := range metrics {
+		norm, err := normalizeRelayURL(rm.Url)
+		if norm == rm.Url && err == nil {
+			continue
+		}
+		if err := tx.Delete(&RelayMetric{}, "url = ? and hour = ?", rm.Url, rm.Hour).Error; err != nil {
+			return err
+		}
+		if err != nil {
+			continue
+		}
+		// counters for the same hour add up
+		var merged RelayMetric
+		if tx.First(&merged, "url = ? and hour = ?", norm, rm.Hour).Error != nil {
+			merged = RelayMetric{Url: norm, Hour: rm.Hour}
+		}
+		merged.Add(rm)
+		if err := tx.Save(&merged).Error; err != nil {
+			return err
+		}
+	}
+
+	var progress []BackfillProgress
+	if err := tx.Find(&progress).Error; err != nil {
+		return err
+	}
+	for _, bp := range progress {
+		norm, err := normalizeRelayURL(bp.Url)
+		if norm == bp.Url && err == nil {
+			continue
+		}
+		if err := tx.Delete(&BackfillProgress{}, "url = ?", bp.Url).Error; err != nil {
+			return err
+		}
+		if err != nil {
+			continue
+		}
+		// keep whichever walk got further back
+		var merged BackfillProgress
+		if tx.First(&merged, "url = ?", norm).Error != nil {
+			merged = BackfillProgress{Url: norm, Until: bp.Until}
+		}
+		if bp.Until.Before(merged.Until) {
+			merged.Until = bp.Until
+		}
+		merged.Events += bp.Events
+		if err := tx.Save(&merged).Error; err != nil {
+			return err
+		}
+	}
+
+	var servers []RecommendServer
+	if err := tx.Order("updated_at desc").Find(&servers).Error; err != nil {
+		return err
+	}
+	type serverKey struct{ pubkey, url, by string }
+	seen := make(map[serverKey]bool)
+	for _, s := range servers {
+		norm, err := normalizeRelayURL(s.Url)
+		key := serverKey{s.PubkeyHex, norm, s.RecommendedBy}
+		if err != nil || seen[key] {
+			if err := tx.Delete(&RecommendServer{}, s.ID).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		seen[key] = true
+		if norm != s.Url {
+			if err := tx.Model(&RecommendServer{}).Where("id = ?", s.ID).UpdateColumn("url", norm).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	var entries []RelayListEntry
+	if err := tx.Order("id").Find(&entries).Error; err != nil {
+		return err
+	}
+	type entryKey struct{ pubkey, url string }
+	seenEntries := make(map[entryKey]bool)
+	for _, e := range entries {
+		norm, err := normalizeRelayURL(e.Url)
+		key := entryKey{e.PubkeyHex, norm}
+		if err != nil || seenEntries[key] {
+			if err := tx.Delete(&RelayListEntry{}, e.ID).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		seenEntries[key] = true
+		if norm != e.Url {
+			if err := tx.Model(&RelayListEntry{}).Where("id = ?", e.ID).UpdateColumn("url", norm).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestNormalizeRelayURL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"wss://relay.example.com", "wss://relay.example.com"},
+		{"  wss://relay.example.com/  ", "wss://relay.example.com"},
+		{"relay.example.com", "wss://relay.example.com"},
+		{"WSS://Relay.Example.com/", "wss://relay.example.com"},
+		{"Wss://relay.example.com", "wss://relay.example.com"},
+		{"wss://RELAY.example.COM", "wss://relay.example.com"},
+		{"ws://relay.example.com:80", "ws://relay.example.com"},
+		{"wss://relay.example.com:443/", "wss://relay.example.com"},
+		{"wss://relay.example.com:4848", "wss://relay.example.com:4848"},
+		{"https://relay.example.com", "wss://relay.example.com"},
+		{"HTTP://relay.example.com", "ws://relay.example.com"},
+		{"wss://relay.example.com/nostr/", "wss://relay.example.com/nostr"},
+		{"ws://localhost:7447", "ws://localhost:7447"},
+		{"ws://127.0.0.1:7447", "ws://127.0.0.1:7447"},
+		{"wss://[::1]:7447", "wss://[::1]:7447"},
+		{"", ""},
+		{"   ", ""},
+		{"ftp://relay.example.com", ""},
+		{"wss://user@relay.example.com", ""},
+		{"wss://relay.example.com/?x=1", ""},
+		{"wss://relay.example.com/#top", ""},
+		{"wss://nodots", ""},
+		{"wss://", ""},
+	}
+	for _, tt := range tests {
+		got, err := normalizeRelayURL(tt.in)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("normalizeRelayURL(%q) = %q, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeRelayURL(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func testDB(t *testing.T) *gorm.DB {
+	TheLog = log.New(io.Discard, "", 0)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, _ := db.DB()
+	sql.SetMaxOpenConns(1)
+	t.Cleanup(func() { sql.Close() })
+	err = db.AutoMigrate(&Metadata{}, &Account{}, &OutboxEvent{}, &RelayStatus{}, &RelayInfo{},
+		&RelayMetric{}, &BackfillProgress{}, &RecommendServer{}, &RelayListEntry{}, &Migration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMergeRelayUrls(t *testing.T) {
+	db := testDB(t)
+	hour := time.Now().Truncate(time.Hour)
+	old := time.Now().Add(-time.Hour)
+
+	db.Create(&RelayStatus{Url: "wss://relay.example.com", Status: "EOSE", UpdatedAt: old})
+	db.Create(&RelayStatus{Url: "WSS://Relay.Example.com/", Status: "waiting", UpdatedAt: time.Now()})
+	db.Create(&RelayStatus{Url: "ftp://bogus", Status: "waiting"})
+	db.Create(&RelayInfo{Url: "Wss://relay.example.com", Name: "newer", FetchedAt: time.Now()})
+	db.Create(&RelayInfo{Url: "wss://relay.example.com", Name: "older", FetchedAt: old})
+	db.Create(&RelayMetric{Url: "wss://relay.example.com", Hour: hour, Events: 2, EventsByKind: `{"1":2}`})
+	db.Create(&RelayMetric{Url: "wss://RELAY.example.com/", Hour: hour, Events: 3, EventsByKind: `{"1":1,"3":2}`})
+	db.Create(&BackfillProgress{Url: "wss://relay.example.com/", Until: old, Events: 5})
+
+	if err := runMigration(db, "normalize relay urls", MergeRelayUrls); err != nil {
+		t.Fatal(err)
+	}
+
+	var statuses []RelayStatus
+	db.Find(&statuses)
+	if len(statuses) != 1 || statuses[0].Url != "wss://relay.example.com" || statuses[0].Status != "waiting" {
+		t.Fatalf("relay statuses %+v", statuses)
+	}
+
+	var infos []RelayInfo
+	db.Find(&infos)
+	if len(infos) != 1 || infos[0].Url != "wss://relay.example.com" || infos[0].Name != "newer" {
+		t.Fatalf("relay infos %+v", infos)
+	}
+
+	var metrics []RelayMetric
+	db.Find(&metrics)
+	if len(metrics) != 1 || metrics[0].Url != "wss://relay.example.com" || metrics[0].Events != 5 {
+		t.Fatalf("relay metrics %+v", metrics)
+	}
+	if byKind := metrics[0].KindCounts(); byKind[1] != 3 || byKind[3] != 2 {
+		t.Fatalf("kind counts %v", byKind)
+	}
+
+	var progress []BackfillProgress
+	db.Find(&progress)
+	if len(progress) != 1 || progress[0].Url != "wss://relay.example.com" || progress[0].Events != 5 {
+		t.Fatalf("backfill progress %+v", progress)
+	}
+
+	// recorded, so it does not run again
+	db.Create(&RelayStatus{Url: "WSS://other.example.com", Status: "waiting"})
+	if err := runMigration(db, "normalize relay urls", MergeRelayUrls); err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	db.Model(&RelayStatus{}).Where("url = ?", "WSS://other.example.com").Count(&n)
+	if n != 1 {
+		t.Fatal("migration ran twice")
+	}
+}
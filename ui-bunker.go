@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// cancels the bunker connection or follow signing that is waiting on a
+// remote signer, nil when nothing is
+var bunkerCancel context.CancelFunc
+var followCancel context.CancelFunc
+
+func addBunker(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	g.DeleteView("config")
+	if v, err := g.SetView("bunker", maxX/2-50, maxY/2-2, maxX/2+50, maxY/2+2, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Remote signer (bunker://...) - [Enter]Connect - [ESC]Cancel"
+		v.Editable = true
+		v.Wrap = true
+		v.KeybindOnEdit = true
+		if _, err := g.SetCurrentView("bunker"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func doAddBunker(g *gocui.Gui, v *gocui.View) error {
+	if bunkerCancel != nil {
+		return nil
+	}
+	uri := strings.TrimSpace(v.Buffer())
+	if _, err := ParseBunkerURI(uri); err != nil {
+		v.Title = fmt.Sprintf("%s - [ESC]Cancel", err)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(CTX, bunkerTimeout)
+	bunkerCancel = cancel
+	v.Editable = false
+	v.Clear()
+	v.Title = "Remote signer - connecting - [ESC]Cancel"
+	fmt.Fprintf(v, "waiting for the remote signer to accept the connection...\n")
+
+	onAuthURL := func(url string) {
+		g.Update(func(g *gocui.Gui) error {
+			if v, err := g.View("bunker"); err == nil {
+				fmt.Fprintf(v, "approve the connection at %s\n", url)
+			}
+			return nil
+		})
+	}
+	go func() {
+		account, err := Keys.AddBunker(ctx, ViewDB, uri, onAuthURL)
+		cancel()
+		g.Update(func(g *gocui.Gui) error {
+			bunkerCancel = nil
+			v, verr := g.View("bunker")
+			if verr != nil {
+				return nil
+			}
+			if err != nil {
+				TheLog.Printf("bunker connect failed: %s\n", err)
+				v.Clear()
+				v.Editable = true
+				v.Title = "Remote signer (bunker://...) - [Enter]Connect - [ESC]Cancel"
+				fmt.Fprintf(v, "%s", uri)
+				return showError(g, "Could not connect to remote signer", err)
+			}
+			TheLog.Printf("added remote signer account %s\n", account.PubkeyNpub)
+			return cancelBunker(g, v)
+		})
+	}()
+	return nil
+}
+
+func cancelBunker(g *gocui.Gui, v *gocui.View) error {
+	if bunkerCancel != nil {
+		bunkerCancel()
+		bunkerCancel = nil
+	}
+	g.DeleteView("bunker")
+	g.SetCurrentView("v2")
+	return nil
+}
+
+// sign the new contact list with the remote signer, showing that we're
+// waiting for approval in the follow dialog until it answers
+func signFollowRemotely(g *gocui.Gui, ev nostr.Event, description string) error {
+	v, err := g.View("follow")
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(CTX, bunkerTimeout)
+	followCancel = cancel
+	v.Clear()
+	v.Title = "Follow - pending approval - (esc) cancel"
+	fmt.Fprintf(v, "waiting for the remote signer to approve the contact list...\n")
+
+	onAuthURL := func(url string) {
+		g.Update(func(g *gocui.Gui) error {
+			if v, err := g.View("follow"); err == nil {
+				fmt.Fprintf(v, "approve at %s\n", url)
+			}
+			return nil
+		})
+	}
+	go func() {
+		err := Keys.SignWithApproval(ctx, ev.PubKey, &ev, onAuthURL)
+		cancelled := ctx.Err() == context.Canceled
+		cancel()
+		g.Update(func(g *gocui.Gui) error {
+			followCancel = nil
+			if cancelled {
+				return nil
+			}
+			g.DeleteView("follow")
+			g.SetCurrentView("v2")
+			if err != nil {
+				TheLog.Printf("error signing contact list: %s", err)
+				return showError(g, "Could not sign contact list", err)
+			}
+			highlighted = []string{}
+			id := QueueEvent(ViewDB, ev, description)
+			return showPublishStatus(g, id)
+		})
+	}()
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// the active account's pubkey, cached so bus handlers don't hit the db
+var activePubkey string
+var activePubkeyMu sync.Mutex
+
+func loadActivePubkey() string {
+	var account Account
+	ViewDB.First(&account, "active = ?", true)
+	activePubkeyMu.Lock()
+	defer activePubkeyMu.Unlock()
+	activePubkey = account.Pubkey
+	return activePubkey
+}
+
+func isActivePubkey(pubkey string) bool {
+	activePubkeyMu.Lock()
+	defer activePubkeyMu.Unlock()
+	return pubkey != "" && pubkey == activePubkey
+}
+
+// push relay, ingestion and outbox changes into the views
+func subscribeUI(g *gocui.Gui) {
+	loadActivePubkey()
+
+	Bus.Subscribe(TopicRelayStatus, func(m BusMessage) {
+		g.Update(func(g *gocui.Gui) error {
+			return refreshRelays(g, nil)
+		})
+	})
+	Bus.Subscribe(TopicProfile, func(m BusMessage) {
+		if isActivePubkey(m.Pubkey) {
+			g.Update(refreshHeader)
+		}
+	})
+	Bus.Subscribe(TopicOutbox, func(m BusMessage) {
+		g.Update(func(g *gocui.Gui) error {
+			refreshOutbox(g)
+			return refreshHeader(g)
+		})
+	})
+	Bus.Subscribe(TopicRefetch, func(m BusMessage) {
+		g.Update(func(g *gocui.Gui) error {
+			return refreshDetails(g, m.Pubkey)
+		})
+	})
+	tickRefetchStatus(g)
+	Bus.Subscribe(TopicAccount, func(m BusMessage) {
+		loadActivePubkey()
+		g.Update(func(g *gocui.Gui) error {
+			refreshV5(g, nil)
+			return refreshHeader(g)
+		})
+	})
+}
+
+// first run: offer to use our published relay list once it arrives
+func offerSeedRelaysOnArrival(g *gocui.Gui) {
+	var once sync.Once
+	Bus.Subscribe(TopicProfile, func(m BusMessage) {
+		if m.Kind != KindRelayList || !isActivePubkey(m.Pubkey) {
+			return
+		}
+		once.Do(func() {
+			entries := GetRelayList(ViewDB, m.Pubkey)
+			if len(entries) == 0 {
+				return
+			}
+			g.Update(func(g *gocui.Gui) error {
+				return offerSeedRelays(g, entries)
+			})
+		})
+	})
+}
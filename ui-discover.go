@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// the relays shown in the discover view and their probe results
+var discovered []DiscoveredRelay
+var probeResults = make(map[string]string)
+var probeResultsMu sync.Mutex
+
+func refreshDiscover(g *gocui.Gui) error {
+	v, err := g.View("discover")
+	if err != nil {
+		return nil
+	}
+	v.Clear()
+	if len(discovered) == 0 {
+		fmt.Fprintf(v, "no new relays recommended by your follows yet\n")
+		return nil
+	}
+	probeResultsMu.Lock()
+	defer probeResultsMu.Unlock()
+	for _, d := range discovered {
+		fmt.Fprintf(v, "%4d follows  %-12s %-40s %s\n", d.Recommenders, d.LastSeen.Format("Jan 02 2006"), d.Url, probeResults[d.Url])
+	}
+	return nil
+}
+
+// rank the relays our follows recommend
+func discoverRelays(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	account := Account{}
+	if aerr := ViewDB.First(&account, "active = ?", true).Error; aerr != nil {
+		TheLog.Printf("error getting active account: %s", aerr)
+		return nil
+	}
+	discovered = DiscoverRelays(ViewDB, account.Pubkey)
+	if v, err := g.SetView("discover", maxX/2-60, maxY/2-12, maxX/2+60, maxY/2+12, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Discover Relays - [a]dd relay - [p]robe first - [ESC]Cancel"
+		v.Highlight = true
+		v.SelBgColor = gocui.ColorGreen
+		v.SelFgColor = gocui.ColorBlack
+		v.Editable = false
+		v.KeybindOnEdit = true
+		if _, err := g.SetCurrentView("discover"); err != nil {
+			return err
+		}
+	}
+	return refreshDiscover(g)
+}
+
+func discoverSelected(v *gocui.View) (DiscoveredRelay, bool) {
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	if cy+oy >= len(discovered) {
+		return DiscoveredRelay{}, false
+	}
+	return discovered[cy+oy], true
+}
+
+func cursorDownDiscover(g *gocui.Gui, v *gocui.View) error {
+	return listCursorDown(v, len(discovered))
+}
+
+func adoptDiscovered(g *gocui.Gui, v *gocui.View) error {
+	d, ok := discoverSelected(v)
+	if !ok {
+		return nil
+	}
+	err := ViewDB.Create(&RelayStatus{Url: d.Url, Status: "waiting"}).Error
+	if err != nil {
+		TheLog.Printf("error adding relay %s: %s", d.Url, err)
+		return nil
+	}
+	SendRelayCommand(RelayAdd, d.Url)
+	v.Title = fmt.Sprintf("Discover Relays - added %s", d.Url)
+	return nil
+}
+
+func probeDiscovered(g *gocui.Gui, v *gocui.View) error {
+	d, ok := discoverSelected(v)
+	if !ok {
+		return nil
+	}
+	probeResultsMu.Lock()
+	probeResults[d.Url] = "⌛ probing"
+	probeResultsMu.Unlock()
+	go func() {
+		result := ProbeRelay(ViewDB, CTX, d.Url)
+		probeResultsMu.Lock()
+		probeResults[d.Url] = result
+		probeResultsMu.Unlock()
+		g.Update(refreshDiscover)
+	}()
+	return refreshDiscover(g)
+}
+
+func cancelDiscover(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("discover")
+	g.SetCurrentView("v4")
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// the view to go back to when the error is dismissed
+var errorReturnView = "v2"
+
+// show an error popup on top of everything else
+func showError(g *gocui.Gui, title string, cause error) error {
+	return showMessage(g, title, cause.Error())
+}
+
+// show a message popup on top of everything else
+func showMessage(g *gocui.Gui, title string, text string) error {
+	maxX, maxY := g.Size()
+	if cur := g.CurrentView(); cur != nil && cur.Name() != "error" {
+		errorReturnView = cur.Name()
+	}
+	v, err := g.SetView("error", maxX/2-40, maxY/2-2, maxX/2+40, maxY/2+2, 0)
+	if err != nil && !errors.Is(err, gocui.ErrUnknownView) {
+		return err
+	}
+	v.Clear()
+	v.Title = title + " - [ESC]Dismiss"
+	v.Wrap = true
+	v.Editable = false
+	v.KeybindOnEdit = true
+	fmt.Fprintf(v, "%s\n", text)
+	if _, err := g.SetCurrentView("error"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func dismissError(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("error")
+	if _, err := g.SetCurrentView(errorReturnView); err != nil {
+		g.SetCurrentView("v2")
+	}
+	return nil
+}
@@ -9,187 +9,496 @@ import (
 func keybindings(g *gocui.Gui) error {
 	/* global for all Views */
 	// q key (quit)
-	if err := g.SetKeybinding("", rune(0x71), gocui.ModNone, quit); err != nil {
+	if err := setKeybinding(g, "", rune(0x71), gocui.ModNone, quit); err != nil {
 		log.Panicln(err)
 	}
 	// s key (search)
-	if err := g.SetKeybinding("", rune(0x73), gocui.ModNone, search); err != nil {
+	if err := setKeybinding(g, "", rune(0x73), gocui.ModNone, search); err != nil {
 		log.Panicln(err)
 	}
 	// tab key (next window)
-	if err := g.SetKeybinding("", gocui.KeyTab, gocui.ModNone, next); err != nil {
+	if err := setKeybinding(g, "", gocui.KeyTab, gocui.ModNone, next); err != nil {
 		log.Panicln(err)
 	}
 	// r key (refresh)
-	if err := g.SetKeybinding("", rune(0x72), gocui.ModNone, refreshAll); err != nil {
+	if err := setKeybinding(g, "", rune(0x72), gocui.ModNone, refreshAll); err != nil {
 		log.Panicln(err)
 	}
 	// c key (Config)
-	if err := g.SetKeybinding("", rune(0x63), gocui.ModNone, config); err != nil {
+	if err := setKeybinding(g, "", rune(0x63), gocui.ModNone, config); err != nil {
 		log.Panicln(err)
 	}
 	// f key (Follow)
-	if err := g.SetKeybinding("", rune(0x66), gocui.ModNone, follow); err != nil {
+	if err := setKeybinding(g, "", rune(0x66), gocui.ModNone, follow); err != nil {
+		log.Panicln(err)
+	}
+
+	// P key (last publish status)
+	if err := setKeybinding(g, "", rune(0x50), gocui.ModNone, lastPublishStatus); err != nil {
+		log.Panicln(err)
+	}
+
+	// O key (outbox)
+	if err := setKeybinding(g, "", rune(0x4f), gocui.ModNone, showOutbox); err != nil {
+		log.Panicln(err)
+	}
+
+	// L key (lock now)
+	if err := setKeybinding(g, "", rune(0x4c), gocui.ModNone, lockNow); err != nil {
+		log.Panicln(err)
+	}
+
+	/* lock view */
+	if err := setKeybinding(g, "lock", gocui.KeyEnter, gocui.ModNone, doUnlock); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "lock", gocui.KeyEsc, gocui.ModNone, browseLocked); err != nil {
 		log.Panicln(err)
 	}
 
 	/* v2 View (main) */
 	// cursor
-	if err := g.SetKeybinding("v2", gocui.KeyArrowDown, gocui.ModNone, cursorDownV2); err != nil {
+	if err := setKeybinding(g, "v2", gocui.KeyArrowDown, gocui.ModNone, cursorDownV2); err != nil {
 		log.Panicln(err)
 	}
-	if err := g.SetKeybinding("v2", gocui.KeyArrowUp, gocui.ModNone, cursorUpV2); err != nil {
+	if err := setKeybinding(g, "v2", gocui.KeyArrowUp, gocui.ModNone, cursorUpV2); err != nil {
 		log.Panicln(err)
 	}
 	// vim cursor
 	// j key (down)
-	if err := g.SetKeybinding("v2", rune(0x6a), gocui.ModNone, cursorDownV2); err != nil {
+	if err := setKeybinding(g, "v2", rune(0x6a), gocui.ModNone, cursorDownV2); err != nil {
 		log.Panicln(err)
 	}
 	// k key (up)
-	if err := g.SetKeybinding("v2", rune(0x6b), gocui.ModNone, cursorUpV2); err != nil {
+	if err := setKeybinding(g, "v2", rune(0x6b), gocui.ModNone, cursorUpV2); err != nil {
 		log.Panicln(err)
 	}
 	// pageup and pagedown
-	if err := g.SetKeybinding("v2", gocui.KeyPgup, gocui.ModNone, pageUp); err != nil {
+	if err := setKeybinding(g, "v2", gocui.KeyPgup, gocui.ModNone, pageUp); err != nil {
 		log.Panicln(err)
 	}
-	if err := g.SetKeybinding("v2", gocui.KeyPgdn, gocui.ModNone, pageDown); err != nil {
+	if err := setKeybinding(g, "v2", gocui.KeyPgdn, gocui.ModNone, pageDown); err != nil {
 		log.Panicln(err)
 	}
 	// a key (add recommend relay)
-	if err := g.SetKeybinding("v2", rune(0x61), gocui.ModNone, addRelay); err != nil {
+	if err := setKeybinding(g, "v2", rune(0x61), gocui.ModNone, addRelay); err != nil {
 		log.Panicln(err)
 	}
 	// spacebar key (select)
-	if err := g.SetKeybinding("v2", gocui.KeySpace, gocui.ModNone, selectBar); err != nil {
+	if err := setKeybinding(g, "v2", gocui.KeySpace, gocui.ModNone, selectBar); err != nil {
 		log.Panicln(err)
 	}
 	// z key (select all)
-	if err := g.SetKeybinding("v2", rune(0x7a), gocui.ModNone, selectAll); err != nil {
+	if err := setKeybinding(g, "v2", rune(0x7a), gocui.ModNone, selectAll); err != nil {
 		log.Panicln(err)
 	}
 	// enter key (ask)
-	if err := g.SetKeybinding("v2", gocui.KeyEnter, gocui.ModNone, askExpand); err != nil {
+	if err := setKeybinding(g, "v2", gocui.KeyEnter, gocui.ModNone, askExpand); err != nil {
+		log.Panicln(err)
+	}
+	// g key (get latest from relays)
+	if err := setKeybinding(g, "v2", rune(0x67), gocui.ModNone, refetchSelected); err != nil {
 		log.Panicln(err)
 	}
 
 	/* v4 View (Relay List) */
 	// d key (delete)
-	if err := g.SetKeybinding("v4", rune(0x64), gocui.ModNone, delRelay); err != nil {
+	if err := setKeybinding(g, "v4", rune(0x64), gocui.ModNone, delRelay); err != nil {
 		log.Panicln(err)
 	}
 	// cursor
-	if err := g.SetKeybinding("v4", gocui.KeyArrowDown, gocui.ModNone, cursorDownV4); err != nil {
+	if err := setKeybinding(g, "v4", gocui.KeyArrowDown, gocui.ModNone, cursorDownV4); err != nil {
 		log.Panicln(err)
 	}
-	if err := g.SetKeybinding("v4", gocui.KeyArrowUp, gocui.ModNone, cursorUpV4); err != nil {
+	if err := setKeybinding(g, "v4", gocui.KeyArrowUp, gocui.ModNone, cursorUpV4); err != nil {
 		log.Panicln(err)
 	}
 	// vim cursor
 	// j key (down)
-	if err := g.SetKeybinding("v4", rune(0x6a), gocui.ModNone, cursorDownV4); err != nil {
+	if err := setKeybinding(g, "v4", rune(0x6a), gocui.ModNone, cursorDownV4); err != nil {
 		log.Panicln(err)
 	}
 	// k key (up)
-	if err := g.SetKeybinding("v4", rune(0x6b), gocui.ModNone, cursorUpV4); err != nil {
+	if err := setKeybinding(g, "v4", rune(0x6b), gocui.ModNone, cursorUpV4); err != nil {
 		log.Panicln(err)
 	}
 	// a key (add new relay)
-	if err := g.SetKeybinding("v4", rune(0x61), gocui.ModNone, addRelay); err != nil {
+	if err := setKeybinding(g, "v4", rune(0x61), gocui.ModNone, addRelay); err != nil {
+		log.Panicln(err)
+	}
+	// i key (relay info)
+	if err := setKeybinding(g, "v4", rune(0x69), gocui.ModNone, relayInfo); err != nil {
+		log.Panicln(err)
+	}
+	// enter key (relay info)
+	if err := setKeybinding(g, "v4", gocui.KeyEnter, gocui.ModNone, relayInfo); err != nil {
+		log.Panicln(err)
+	}
+
+	// t key (toggle auth)
+	if err := setKeybinding(g, "v4", rune(0x74), gocui.ModNone, toggleRelayAuth); err != nil {
+		log.Panicln(err)
+	}
+	// o key (outbox fetch)
+	if err := setKeybinding(g, "v4", rune(0x6f), gocui.ModNone, outboxFetch); err != nil {
+		log.Panicln(err)
+	}
+	// D key (discover relays)
+	if err := setKeybinding(g, "v4", rune(0x44), gocui.ModNone, discoverRelays); err != nil {
+		log.Panicln(err)
+	}
+	// l key (my relay list)
+	if err := setKeybinding(g, "v4", rune(0x6c), gocui.ModNone, relayList); err != nil {
+		log.Panicln(err)
+	}
+
+	/* relaylist view */
+	// cancel key
+	if err := setKeybinding(g, "relaylist", gocui.KeyEsc, gocui.ModNone, cancelRelayList); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "relaylist", gocui.KeyArrowDown, gocui.ModNone, cursorDownRelayList); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "relaylist", gocui.KeyArrowUp, gocui.ModNone, listCursorUp); err != nil {
+		log.Panicln(err)
+	}
+	// j key (down)
+	if err := setKeybinding(g, "relaylist", rune(0x6a), gocui.ModNone, cursorDownRelayList); err != nil {
+		log.Panicln(err)
+	}
+	// k key (up)
+	if err := setKeybinding(g, "relaylist", rune(0x6b), gocui.ModNone, listCursorUp); err != nil {
+		log.Panicln(err)
+	}
+	// a key (add)
+	if err := setKeybinding(g, "relaylist", rune(0x61), gocui.ModNone, relayListAdd); err != nil {
+		log.Panicln(err)
+	}
+	// d key (delete)
+	if err := setKeybinding(g, "relaylist", rune(0x64), gocui.ModNone, relayListDelete); err != nil {
+		log.Panicln(err)
+	}
+	// r key (toggle read)
+	if err := setKeybinding(g, "relaylist", rune(0x72), gocui.ModNone, relayListToggleRead); err != nil {
+		log.Panicln(err)
+	}
+	// w key (toggle write)
+	if err := setKeybinding(g, "relaylist", rune(0x77), gocui.ModNone, relayListToggleWrite); err != nil {
+		log.Panicln(err)
+	}
+	// p key (publish)
+	if err := setKeybinding(g, "relaylist", rune(0x70), gocui.ModNone, relayListPublish); err != nil {
+		log.Panicln(err)
+	}
+	// s key (seed local relays)
+	if err := setKeybinding(g, "relaylist", rune(0x73), gocui.ModNone, relayListSeed); err != nil {
+		log.Panicln(err)
+	}
+
+	/* relaylistadd view */
+	if err := setKeybinding(g, "relaylistadd", gocui.KeyEnter, gocui.ModNone, doRelayListAdd); err != nil {
+		log.Panicln(err)
+	}
+	// cancel key
+	if err := setKeybinding(g, "relaylistadd", gocui.KeyEsc, gocui.ModNone, cancelRelayListAdd); err != nil {
+		log.Panicln(err)
+	}
+
+	/* seedrelays view */
+	// y key for (YES)
+	if err := setKeybinding(g, "seedrelays", rune(0x79), gocui.ModNone, doSeedRelays); err != nil {
+		log.Panicln(err)
+	}
+	// n key (for NO)
+	if err := setKeybinding(g, "seedrelays", rune(0x6e), gocui.ModNone, cancelSeedRelays); err != nil {
+		log.Panicln(err)
+	}
+	// cancel key
+	if err := setKeybinding(g, "seedrelays", gocui.KeyEsc, gocui.ModNone, cancelSeedRelays); err != nil {
+		log.Panicln(err)
+	}
+
+	/* publishstatus view */
+	// cancel key
+	if err := setKeybinding(g, "publishstatus", gocui.KeyEsc, gocui.ModNone, cancelPublishStatus); err != nil {
+		log.Panicln(err)
+	}
+	// r key (retry)
+	if err := setKeybinding(g, "publishstatus", rune(0x72), gocui.ModNone, retryPublish); err != nil {
+		log.Panicln(err)
+	}
+
+	/* outbox view */
+	// cancel key
+	if err := setKeybinding(g, "outbox", gocui.KeyEsc, gocui.ModNone, cancelOutbox); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "outbox", gocui.KeyArrowDown, gocui.ModNone, cursorDownOutbox); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "outbox", gocui.KeyArrowUp, gocui.ModNone, listCursorUp); err != nil {
+		log.Panicln(err)
+	}
+	// r key (retry all)
+	if err := setKeybinding(g, "outbox", rune(0x72), gocui.ModNone, retryOutbox); err != nil {
+		log.Panicln(err)
+	}
+	// d key (drop)
+	if err := setKeybinding(g, "outbox", rune(0x64), gocui.ModNone, dropOutbox); err != nil {
+		log.Panicln(err)
+	}
+	// enter key (publish status)
+	if err := setKeybinding(g, "outbox", gocui.KeyEnter, gocui.ModNone, outboxPublishStatus); err != nil {
+		log.Panicln(err)
+	}
+
+	/* discover view */
+	// cancel key
+	if err := setKeybinding(g, "discover", gocui.KeyEsc, gocui.ModNone, cancelDiscover); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "discover", gocui.KeyArrowDown, gocui.ModNone, cursorDownDiscover); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "discover", gocui.KeyArrowUp, gocui.ModNone, listCursorUp); err != nil {
+		log.Panicln(err)
+	}
+	// j key (down)
+	if err := setKeybinding(g, "discover", rune(0x6a), gocui.ModNone, cursorDownDiscover); err != nil {
+		log.Panicln(err)
+	}
+	// k key (up)
+	if err := setKeybinding(g, "discover", rune(0x6b), gocui.ModNone, listCursorUp); err != nil {
+		log.Panicln(err)
+	}
+	// a key (add relay)
+	if err := setKeybinding(g, "discover", rune(0x61), gocui.ModNone, adoptDiscovered); err != nil {
+		log.Panicln(err)
+	}
+	// p key (probe relay)
+	if err := setKeybinding(g, "discover", rune(0x70), gocui.ModNone, probeDiscovered); err != nil {
+		log.Panicln(err)
+	}
+
+	/* relayinfo view */
+	// cancel key
+	if err := setKeybinding(g, "relayinfo", gocui.KeyEsc, gocui.ModNone, cancelRelayInfo); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "relayinfo", gocui.KeyArrowDown, gocui.ModNone, cursorDownV3); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "relayinfo", gocui.KeyArrowUp, gocui.ModNone, cursorUpV3); err != nil {
+		log.Panicln(err)
+	}
+	// u key (update relay info)
+	if err := setKeybinding(g, "relayinfo", rune(0x75), gocui.ModNone, updateRelayInfo); err != nil {
 		log.Panicln(err)
 	}
 
 	/* v3 view (expanded metadata) */
+	// g key (get latest from relays)
+	if err := setKeybinding(g, "v3", rune(0x67), gocui.ModNone, refetchSelected); err != nil {
+		log.Panicln(err)
+	}
 	// cursor
 	/*
-		if err := g.SetKeybinding("v3", gocui.KeyArrowDown, gocui.ModNone, cursorDownV3); err != nil {
+		if err := setKeybinding(g, "v3", gocui.KeyArrowDown, gocui.ModNone, cursorDownV3); err != nil {
 			log.Panicln(err)
 		}
-		if err := g.SetKeybinding("v3", gocui.KeyArrowUp, gocui.ModNone, cursorUpV3); err != nil {
+		if err := setKeybinding(g, "v3", gocui.KeyArrowUp, gocui.ModNone, cursorUpV3); err != nil {
 			log.Panicln(err)
 		}
 		// vim cursor
 		// j key (down)
-		if err := g.SetKeybinding("v3", rune(0x6a), gocui.ModNone, cursorDownV3); err != nil {
+		if err := setKeybinding(g, "v3", rune(0x6a), gocui.ModNone, cursorDownV3); err != nil {
 			log.Panicln(err)
 		}
 		// k key (up)
-		if err := g.SetKeybinding("v3", rune(0x6b), gocui.ModNone, cursorUpV3); err != nil {
+		if err := setKeybinding(g, "v3", rune(0x6b), gocui.ModNone, cursorUpV3); err != nil {
 			log.Panicln(err)
 		}
 	*/
 
 	/* search view */
-	if err := g.SetKeybinding("msg", gocui.KeyEnter, gocui.ModNone, doSearch); err != nil {
+	if err := setKeybinding(g, "msg", gocui.KeyEnter, gocui.ModNone, doSearch); err != nil {
 		log.Panicln(err)
 	}
 
 	/* addrelay view */
-	if err := g.SetKeybinding("addrelay", gocui.KeyEnter, gocui.ModNone, doAddRelay); err != nil {
+	if err := setKeybinding(g, "addrelay", gocui.KeyEnter, gocui.ModNone, doAddRelay); err != nil {
 		log.Panicln(err)
 	}
 	//cancel key
-	if err := g.SetKeybinding("addrelay", gocui.KeyEsc, gocui.ModNone, cancelAddRelay); err != nil {
+	if err := setKeybinding(g, "addrelay", gocui.KeyEsc, gocui.ModNone, cancelAddRelay); err != nil {
 		log.Panicln(err)
 	}
 
 	/* config view for accounts */
 	//cancel key
-	if err := g.SetKeybinding("config", gocui.KeyEsc, gocui.ModNone, cancelConfig); err != nil {
+	if err := setKeybinding(g, "config", gocui.KeyEsc, gocui.ModNone, cancelConfig); err != nil {
 		log.Panicln(err)
 	}
-	if err := g.SetKeybinding("config", gocui.KeyEnter, gocui.ModNone, activateConfig); err != nil {
+	if err := setKeybinding(g, "config", gocui.KeyEnter, gocui.ModNone, activateConfig); err != nil {
 		log.Panicln(err)
 	}
 	// g key generate key
-	if err := g.SetKeybinding("config", rune(0x67), gocui.ModNone, generateConfig); err != nil {
+	if err := setKeybinding(g, "config", rune(0x67), gocui.ModNone, generateConfig); err != nil {
 		log.Panicln(err)
 	}
 	// unsupported: edit
-	//if err := g.SetKeybinding("config", gocui.KeyEnter, gocui.ModNone, configEdit); err != nil {
+	//if err := setKeybinding(g, "config", gocui.KeyEnter, gocui.ModNone, configEdit); err != nil {
 	//	log.Panicln(err)
 	//}
 	// n key (new config)
-	if err := g.SetKeybinding("config", rune(0x6e), gocui.ModNone, configNew); err != nil {
+	if err := setKeybinding(g, "config", rune(0x6e), gocui.ModNone, configNew); err != nil {
 		log.Panicln(err)
 	}
 	// d key (delete config)
-	if err := g.SetKeybinding("config", rune(0x64), gocui.ModNone, doConfigDel); err != nil {
+	if err := setKeybinding(g, "config", rune(0x64), gocui.ModNone, doConfigDel); err != nil {
 		log.Panicln(err)
 	}
-	if err := g.SetKeybinding("config", gocui.KeyArrowDown, gocui.ModNone, cursorDownConfig); err != nil {
+	if err := setKeybinding(g, "config", gocui.KeyArrowDown, gocui.ModNone, cursorDownConfig); err != nil {
 		log.Panicln(err)
 	}
-	if err := g.SetKeybinding("config", gocui.KeyArrowUp, gocui.ModNone, cursorUpConfig); err != nil {
+	if err := setKeybinding(g, "config", gocui.KeyArrowUp, gocui.ModNone, cursorUpConfig); err != nil {
 		log.Panicln(err)
 	}
 	// p key (show private key)
-	if err := g.SetKeybinding("config", rune(0x70), gocui.ModNone, configShowPrivateKey); err != nil {
+	if err := setKeybinding(g, "config", rune(0x70), gocui.ModNone, configShowPrivateKey); err != nil {
+		log.Panicln(err)
+	}
+	// m key (generate from seed words)
+	if err := setKeybinding(g, "config", rune(0x6d), gocui.ModNone, generateMnemonic); err != nil {
+		log.Panicln(err)
+	}
+	// r key (restore from seed words)
+	if err := setKeybinding(g, "config", rune(0x72), gocui.ModNone, restoreFromMnemonic); err != nil {
+		log.Panicln(err)
+	}
+	// o key (add watch-only account)
+	if err := setKeybinding(g, "config", rune(0x6f), gocui.ModNone, addWatchOnly); err != nil {
+		log.Panicln(err)
+	}
+	// b key (add remote signer account)
+	if err := setKeybinding(g, "config", rune(0x62), gocui.ModNone, addBunker); err != nil {
+		log.Panicln(err)
+	}
+	// i key (import an event signed offline)
+	if err := setKeybinding(g, "config", rune(0x69), gocui.ModNone, importSigned); err != nil {
+		log.Panicln(err)
+	}
+	// x key (export ncryptsec)
+	if err := setKeybinding(g, "config", rune(0x78), gocui.ModNone, exportKey); err != nil {
+		log.Panicln(err)
+	}
+	// w key (change password)
+	if err := setKeybinding(g, "config", rune(0x77), gocui.ModNone, changePassword); err != nil {
+		log.Panicln(err)
+	}
+
+	/* error popup */
+	if err := setKeybinding(g, "error", gocui.KeyEsc, gocui.ModNone, dismissError); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "error", gocui.KeyEnter, gocui.ModNone, dismissError); err != nil {
+		log.Panicln(err)
+	}
+
+	/* mnemonic views */
+	if err := setKeybinding(g, "mnemonic", gocui.KeyEnter, gocui.ModNone, confirmMnemonic); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "mnemonic", gocui.KeyEsc, gocui.ModNone, cancelMnemonic); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "mnemoniccheck", gocui.KeyEnter, gocui.ModNone, doConfirmMnemonic); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "mnemoniccheck", gocui.KeyEsc, gocui.ModNone, cancelMnemonic); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "restore", gocui.KeyEnter, gocui.ModNone, doRestoreFromMnemonic); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "restore", gocui.KeyEsc, gocui.ModNone, cancelRestore); err != nil {
+		log.Panicln(err)
+	}
+
+	/* watchonly view */
+	if err := setKeybinding(g, "watchonly", gocui.KeyEnter, gocui.ModNone, doAddWatchOnly); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "watchonly", gocui.KeyEsc, gocui.ModNone, cancelWatchOnly); err != nil {
+		log.Panicln(err)
+	}
+
+	/* importsigned view */
+	if err := setKeybinding(g, "importsigned", gocui.KeyEnter, gocui.ModNone, doImportSigned); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "importsigned", gocui.KeyEsc, gocui.ModNone, cancelImportSigned); err != nil {
+		log.Panicln(err)
+	}
+
+	/* bunker view */
+	if err := setKeybinding(g, "bunker", gocui.KeyEnter, gocui.ModNone, doAddBunker); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "bunker", gocui.KeyEsc, gocui.ModNone, cancelBunker); err != nil {
+		log.Panicln(err)
+	}
+
+	/* importpass view */
+	if err := setKeybinding(g, "importpass", gocui.KeyEnter, gocui.ModNone, doImportPassword); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "importpass", gocui.KeyEsc, gocui.ModNone, cancelImportPassword); err != nil {
+		log.Panicln(err)
+	}
+
+	/* exportkey view */
+	if err := setKeybinding(g, "exportkey", gocui.KeyEnter, gocui.ModNone, doExportKey); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "exportkey", gocui.KeyEsc, gocui.ModNone, cancelExportKey); err != nil {
+		log.Panicln(err)
+	}
+
+	/* changepw view */
+	if err := setKeybinding(g, "changepw", gocui.KeyEnter, gocui.ModNone, doChangePassword); err != nil {
+		log.Panicln(err)
+	}
+	if err := setKeybinding(g, "changepw", gocui.KeyEsc, gocui.ModNone, cancelChangePassword); err != nil {
 		log.Panicln(err)
 	}
 	/* config submenu (new/edit) */
 	//cancel key
-	if err := g.SetKeybinding("confignew", gocui.KeyEsc, gocui.ModNone, cancelConfigNew); err != nil {
+	if err := setKeybinding(g, "confignew", gocui.KeyEsc, gocui.ModNone, cancelConfigNew); err != nil {
 		log.Panicln(err)
 	}
 
-	if err := g.SetKeybinding("confignew", gocui.KeyEnter, gocui.ModNone, doConfigNew); err != nil {
+	if err := setKeybinding(g, "confignew", gocui.KeyEnter, gocui.ModNone, doConfigNew); err != nil {
 		log.Panicln(err)
 	}
 
 	//cancel key
-	if err := g.SetKeybinding("configshow", gocui.KeyEsc, gocui.ModNone, cancelConfigShow); err != nil {
+	if err := setKeybinding(g, "configshow", gocui.KeyEsc, gocui.ModNone, cancelConfigShow); err != nil {
 		log.Panicln(err)
 	}
 
 	/* follow view */
 	// n key (for NO)
-	if err := g.SetKeybinding("follow", rune(0x6e), gocui.ModNone, cancelFollow); err != nil {
+	if err := setKeybinding(g, "follow", rune(0x6e), gocui.ModNone, cancelFollow); err != nil {
 		log.Panicln(err)
 	}
 	// y key for (YES)
-	if err := g.SetKeybinding("follow", rune(0x79), gocui.ModNone, doFollow); err != nil {
+	if err := setKeybinding(g, "follow", rune(0x79), gocui.ModNone, doFollow); err != nil {
+		log.Panicln(err)
+	}
+	// esc key (cancel, also stops waiting on a remote signer)
+	if err := setKeybinding(g, "follow", gocui.KeyEsc, gocui.ModNone, cancelFollow); err != nil {
 		log.Panicln(err)
 	}
 
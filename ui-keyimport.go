@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// the ncryptsec waiting for its password in the import dialog
+var importNcryptsec string
+
+func askImportPassword(g *gocui.Gui, ncryptsec string) error {
+	maxX, maxY := g.Size()
+	importNcryptsec = ncryptsec
+	g.DeleteView("confignew")
+	if v, err := g.SetView("importpass", maxX/2-30, maxY/2, maxX/2+30, maxY/2+2, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "ncryptsec password - [enter] import / [ESC] cancel"
+		v.Editable = true
+		v.KeybindOnEdit = true
+		v.Mask = '*'
+		if _, err := g.SetCurrentView("importpass"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func doImportPassword(g *gocui.Gui, v *gocui.View) error {
+	password := strings.TrimRight(v.Buffer(), "\n")
+	v.Clear()
+	v.SetCursor(0, 0)
+	sk, pk, err := ParsePrivateKey(importNcryptsec, password)
+	if err != nil {
+		v.Title = fmt.Sprintf("%s - [ESC] cancel", err)
+		return nil
+	}
+	if _, err := Keys.Add(ViewDB, sk); err != nil {
+		v.Title = fmt.Sprintf("%s - [ESC] cancel", err)
+		return nil
+	}
+	TheLog.Printf("imported ncryptsec key for %s", pk)
+	return cancelImportPassword(g, v)
+}
+
+func cancelImportPassword(g *gocui.Gui, v *gocui.View) error {
+	importNcryptsec = ""
+	g.DeleteView("importpass")
+	g.SetCurrentView("v2")
+	return nil
+}
+
+// export asks for a new password twice, then shows the ncryptsec
+var exportPubkey string
+var exportPassword []byte
+
+func exportKey(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	_, cy := v.Cursor()
+	var accounts []Account
+	ViewDB.Find(&accounts)
+	if cy >= len(accounts) {
+		return nil
+	}
+	exportPubkey = accounts[cy].Pubkey
+	exportPassword = nil
+	g.DeleteView("config")
+	if v, err := g.SetView("exportkey", maxX/2-30, maxY/2, maxX/2+30, maxY/2+2, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Password for the ncryptsec - [enter] next / [ESC] cancel"
+		v.Editable = true
+		v.KeybindOnEdit = true
+		v.Mask = '*'
+		if _, err := g.SetCurrentView("exportkey"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func doExportKey(g *gocui.Gui, v *gocui.View) error {
+	line := []byte(strings.TrimRight(v.Buffer(), "\n"))
+	v.Clear()
+	v.SetCursor(0, 0)
+	if len(line) == 0 {
+		return nil
+	}
+	if exportPassword == nil {
+		exportPassword = line
+		v.Title = "Confirm password - [enter] export / [ESC] cancel"
+		return nil
+	}
+	if !bytes.Equal(line, exportPassword) {
+		exportPassword = nil
+		v.Title = "Passwords do not match, password - [ESC] cancel"
+		return nil
+	}
+
+	sk, err := Keys.Reveal(exportPubkey)
+	if err != nil {
+		cancelExportKey(g, v)
+		return showError(g, "Could not export key", err)
+	}
+	ncryptsec, err := EncryptNcryptsec(sk, string(exportPassword))
+	cancelExportKey(g, v)
+	if err != nil {
+		return showError(g, "Could not export key", err)
+	}
+
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("configshow", maxX/2-50, maxY/2-2, maxX/2+50, maxY/2+2, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		fmt.Fprintf(v, "%s", ncryptsec)
+		v.Title = "Encrypted private key (NIP-49)  [ESC]Dismiss"
+		v.Wrap = true
+		v.Editable = false
+		v.KeybindOnEdit = true
+		if _, err := g.SetCurrentView("configshow"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cancelExportKey(g *gocui.Gui, v *gocui.View) error {
+	exportPubkey = ""
+	exportPassword = nil
+	g.DeleteView("exportkey")
+	g.SetCurrentView("v2")
+	return nil
+}
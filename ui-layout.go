@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"time"
 
 	"github.com/awesome-gocui/gocui"
 	tcell "github.com/gdamore/tcell/v2"
@@ -24,22 +23,7 @@ func layout(g *gocui.Gui) error {
 		v.Frame = false
 		v.BgColor = useBg
 		v.FgColor = useFg
-		fmt.Fprint(v, AppInfo)
-		go func() {
-			for {
-				time.Sleep(1 * time.Second)
-
-				g.Update(func(g *gocui.Gui) error {
-					showMe := displayMyMetadataShort()
-					v, _ := g.View("v1")
-					v.Clear()
-					padding := "%s %s"
-					fmt.Fprintf(v, padding, AppInfo, showMe)
-					return nil
-				})
-			}
-		}()
-
+		fmt.Fprintf(v, "%s %s", AppInfo, displayMyMetadataShort())
 	}
 
 	if v, err := g.SetView("v2", 0, 1, maxX-20, maxY-20, 0); err != nil {
@@ -100,5 +84,16 @@ func layout(g *gocui.Gui) error {
 
 	}
 
+	return keepLocked(g)
+}
+
+// the header shows the active account, updated from the event bus
+func refreshHeader(g *gocui.Gui) error {
+	v, err := g.View("v1")
+	if err != nil {
+		return nil
+	}
+	v.Clear()
+	fmt.Fprintf(v, "%s %s", AppInfo, displayMyMetadataShort())
 	return nil
 }
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// lock the keys after this long without a key press, override with
+// IDLE_LOCK_MINUTES, 0 never locks
+var idleLockAfter = time.Duration(envInt("IDLE_LOCK_MINUTES", 15)) * time.Minute
+
+// IDLE_LOCK_BROWSE=1 lets the lock screen be put aside to keep browsing
+// without keys
+var idleLockBrowse = envInt("IDLE_LOCK_BROWSE", 0) == 1
+
+var lastActivity time.Time
+var lastActivityMu sync.Mutex
+
+// the view to go back to when unlocked
+var lockReturnView = "v2"
+
+// views that show or take key material, closed when locking
+var keyViews = []string{"config", "configshow", "confignew", "importpass", "exportkey", "changepw", "mnemonic", "mnemoniccheck", "restore", "bunker", "watchonly", "importsigned"}
+
+func touchActivity() {
+	lastActivityMu.Lock()
+	lastActivity = time.Now()
+	lastActivityMu.Unlock()
+}
+
+func idleFor() time.Duration {
+	lastActivityMu.Lock()
+	defer lastActivityMu.Unlock()
+	return time.Since(lastActivity)
+}
+
+// setKeybinding is g.SetKeybinding, with every key press counting as
+// activity.  While the lock view is up only its own keys work.
+func setKeybinding(g *gocui.Gui, viewname string, key interface{}, mod gocui.Modifier, handler func(*gocui.Gui, *gocui.View) error) error {
+	return g.SetKeybinding(viewname, key, mod, func(g *gocui.Gui, v *gocui.View) error {
+		touchActivity()
+		if cur := g.CurrentView(); cur != nil && cur.Name() == "lock" && viewname != "lock" {
+			return nil
+		}
+		return handler(g, v)
+	})
+}
+
+// watch for idle time and lock when it runs out
+func watchIdle(g *gocui.Gui) {
+	touchActivity()
+	// typing into editable views counts too
+	editor := gocui.DefaultEditor
+	gocui.DefaultEditor = gocui.EditorFunc(func(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+		touchActivity()
+		editor.Edit(v, key, ch, mod)
+	})
+	if idleLockAfter <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(15 * time.Second) {
+			if idleFor() >= idleLockAfter && !Keys.Locked() {
+				TheLog.Printf("idle for %s, locking\n", idleLockAfter)
+				g.Update(lockScreen)
+			}
+		}
+	}()
+}
+
+// lock the keys now, or bring back the unlock prompt when already locked
+func lockNow(g *gocui.Gui, v *gocui.View) error {
+	if Keys.Locked() {
+		return showLock(g)
+	}
+	return lockScreen(g)
+}
+
+// wipe the keys and the password and cover the screen
+func lockScreen(g *gocui.Gui) error {
+	Keys.Lock()
+	wipe(Password)
+	Password = nil
+	for _, name := range keyViews {
+		g.DeleteView(name)
+	}
+	wipe(changePwOld)
+	wipe(changePwNew)
+	wipe(exportPassword)
+	changePwOld, changePwNew, exportPassword = nil, nil, nil
+	newMnemonic, restoreMnemonic, importNcryptsec = "", "", ""
+	refreshHeader(g)
+	return showLock(g)
+}
+
+func showLock(g *gocui.Gui) error {
+	maxX, maxY := g.Size()
+	if cur := g.CurrentView(); cur != nil && cur.Name() != "lock" {
+		lockReturnView = cur.Name()
+	}
+	v, err := g.SetView("lock", 0, 0, maxX-1, maxY-1, 0)
+	if err != nil && !errors.Is(err, gocui.ErrUnknownView) {
+		return err
+	}
+	v.Clear()
+	v.Title = "Locked - master password - [Enter]Unlock"
+	if idleLockBrowse {
+		v.Title += " - [ESC]Browse read-only"
+	}
+	v.Editable = true
+	v.KeybindOnEdit = true
+	v.Mask = '*'
+	v.SetCursor(0, 0)
+	return keepLocked(g)
+}
+
+// while the lock view exists it stays on top of anything that pops up, and
+// has the focus
+func keepLocked(g *gocui.Gui) error {
+	if _, err := g.View("lock"); err != nil {
+		return nil
+	}
+	if cur := g.CurrentView(); cur != nil && cur.Name() != "lock" {
+		lockReturnView = cur.Name()
+	}
+	if _, err := g.SetViewOnTop("lock"); err != nil {
+		return err
+	}
+	_, err := g.SetCurrentView("lock")
+	return err
+}
+
+func doUnlock(g *gocui.Gui, v *gocui.View) error {
+	pwd := []byte(strings.TrimRight(v.Buffer(), "\n"))
+	v.Clear()
+	v.SetCursor(0, 0)
+	if len(pwd) == 0 {
+		return nil
+	}
+	if err := CheckPassword(ViewDB, pwd); err != nil {
+		wipe(pwd)
+		v.Title = "Locked - " + err.Error() + " - [Enter]Unlock"
+		return nil
+	}
+	Password = pwd
+	if err := Keys.Unlock(ViewDB, Password); err != nil {
+		TheLog.Printf("some keys could not be decrypted: %s\n", err)
+	}
+	touchActivity()
+	TheLog.Println("unlocked")
+	return closeLock(g)
+}
+
+// put the lock view aside, the keys stay locked
+func browseLocked(g *gocui.Gui, v *gocui.View) error {
+	if !idleLockBrowse {
+		return nil
+	}
+	return closeLock(g)
+}
+
+func closeLock(g *gocui.Gui) error {
+	g.DeleteView("lock")
+	if _, err := g.SetCurrentView(lockReturnView); err != nil {
+		g.SetCurrentView("v2")
+	}
+	refreshHeader(g)
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// a generated mnemonic, kept only until the user confirms they wrote it down
+var newMnemonic string
+var newMnemonicCheck int
+
+// generate a key from new seed words, shown once
+func generateMnemonic(g *gocui.Gui, v *gocui.View) error {
+	words, err := GenerateMnemonic()
+	if err != nil {
+		return showError(g, "Could not generate seed words", err)
+	}
+	newMnemonic = words
+	maxX, maxY := g.Size()
+	g.DeleteView("config")
+	if v, err := g.SetView("mnemonic", maxX/2-50, maxY/2-5, maxX/2+50, maxY/2+5, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Seed words - write them down, they are shown only once - [Enter] done / [ESC] cancel"
+		v.Wrap = true
+		v.Editable = false
+		v.KeybindOnEdit = true
+		for i, w := range strings.Fields(words) {
+			fmt.Fprintf(v, "%2d. %-12s", i+1, w)
+			if (i+1)%6 == 0 {
+				fmt.Fprintf(v, "\n")
+			}
+		}
+		if _, err := g.SetCurrentView("mnemonic"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hide the words and ask for one of them back
+func confirmMnemonic(g *gocui.Gui, v *gocui.View) error {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(strings.Fields(newMnemonic)))))
+	if err != nil {
+		return err
+	}
+	newMnemonicCheck = int(n.Int64())
+	g.DeleteView("mnemonic")
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("mnemoniccheck", maxX/2-30, maxY/2, maxX/2+30, maxY/2+2, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = fmt.Sprintf("Type word #%d to confirm - [ESC] cancel", newMnemonicCheck+1)
+		v.Editable = true
+		v.KeybindOnEdit = true
+		if _, err := g.SetCurrentView("mnemoniccheck"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func doConfirmMnemonic(g *gocui.Gui, v *gocui.View) error {
+	word := strings.ToLower(strings.TrimSpace(v.Buffer()))
+	v.Clear()
+	v.SetCursor(0, 0)
+	if word != strings.Fields(newMnemonic)[newMnemonicCheck] {
+		v.Title = fmt.Sprintf("Wrong, type word #%d - [ESC] cancel and discard", newMnemonicCheck+1)
+		return nil
+	}
+	sk, err := KeyFromMnemonic(newMnemonic, 0)
+	cancelMnemonic(g, v)
+	if err == nil {
+		_, err = Keys.Add(ViewDB, sk)
+	}
+	if err != nil {
+		TheLog.Printf("error saving key from seed words: %s", err)
+		return showError(g, "Could not save the new key", err)
+	}
+	return nil
+}
+
+func cancelMnemonic(g *gocui.Gui, v *gocui.View) error {
+	newMnemonic = ""
+	g.DeleteView("mnemonic")
+	g.DeleteView("mnemoniccheck")
+	g.SetCurrentView("v2")
+	return nil
+}
+
+// restore asks for the words, then which accounts to derive
+var restoreMnemonic string
+
+func restoreFromMnemonic(g *gocui.Gui, v *gocui.View) error {
+	restoreMnemonic = ""
+	maxX, maxY := g.Size()
+	g.DeleteView("config")
+	if v, err := g.SetView("restore", maxX/2-50, maxY/2-2, maxX/2+50, maxY/2+2, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Restore - seed words - [Enter] next / [ESC] cancel"
+		v.Wrap = true
+		v.Editable = true
+		v.KeybindOnEdit = true
+		if _, err := g.SetCurrentView("restore"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parse "2" or "0-3" into account indexes
+func parseAccountRange(s string) ([]uint32, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return []uint32{0}, nil
+	}
+	from, to := s, s
+	if i := strings.Index(s, "-"); i > 0 {
+		from, to = s[:i], s[i+1:]
+	}
+	a, err1 := strconv.ParseUint(strings.TrimSpace(from), 10, 31)
+	b, err2 := strconv.ParseUint(strings.TrimSpace(to), 10, 31)
+	if err1 != nil || err2 != nil || b < a || b-a > 20 {
+		return nil, errors.New("account index must be a number or a range like 0-3")
+	}
+	var out []uint32
+	for i := a; i <= b; i++ {
+		out = append(out, uint32(i))
+	}
+	return out, nil
+}
+
+func doRestoreFromMnemonic(g *gocui.Gui, v *gocui.View) error {
+	line := strings.TrimSpace(v.Buffer())
+	v.Clear()
+	v.SetCursor(0, 0)
+	if restoreMnemonic == "" {
+		if _, err := KeyFromMnemonic(line, 0); err != nil {
+			v.Title = fmt.Sprintf("%s, seed words - [ESC] cancel", err)
+			return nil
+		}
+		restoreMnemonic = cleanMnemonic(line)
+		v.Title = "Restore - account index or range (default 0) - [Enter] restore / [ESC] cancel"
+		return nil
+	}
+
+	indexes, err := parseAccountRange(line)
+	if err != nil {
+		v.Title = fmt.Sprintf("%s - [ESC] cancel", err)
+		return nil
+	}
+	restored := 0
+	var lastErr error
+	for _, i := range indexes {
+		sk, err := KeyFromMnemonic(restoreMnemonic, i)
+		if err == nil {
+			_, err = Keys.Add(ViewDB, sk)
+		}
+		if err != nil {
+			TheLog.Printf("restoring account %d: %s", i, err)
+			lastErr = err
+			continue
+		}
+		restored++
+	}
+	cancelRestore(g, v)
+	if restored == 0 && lastErr != nil {
+		return showError(g, "Nothing restored", lastErr)
+	}
+	return nil
+}
+
+func cancelRestore(g *gocui.Gui, v *gocui.View) error {
+	restoreMnemonic = ""
+	g.DeleteView("restore")
+	g.SetCurrentView("v2")
+	return nil
+}
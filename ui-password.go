@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// the change password dialog asks for the current password, then the new
+// one twice
+var changePwStep int
+var changePwOld []byte
+var changePwNew []byte
+
+var changePwTitles = []string{
+	"Current password - [enter] next / [ESC] cancel",
+	"New password - [enter] next / [ESC] cancel",
+	"Confirm new password - [enter] save / [ESC] cancel",
+}
+
+func changePassword(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	g.DeleteView("config")
+	changePwStep = 0
+	changePwOld = nil
+	changePwNew = nil
+	if v, err := g.SetView("changepw", maxX/2-30, maxY/2, maxX/2+30, maxY/2+2, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = changePwTitles[0]
+		v.Editable = true
+		v.KeybindOnEdit = true
+		v.Mask = '*'
+		if _, err := g.SetCurrentView("changepw"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func doChangePassword(g *gocui.Gui, v *gocui.View) error {
+	if v == nil {
+		return nil
+	}
+	line := []byte(strings.TrimRight(v.Buffer(), "\n"))
+	v.Clear()
+	v.SetCursor(0, 0)
+	if len(line) == 0 {
+		return nil
+	}
+
+	switch changePwStep {
+	case 0:
+		changePwOld = line
+	case 1:
+		changePwNew = line
+	case 2:
+		if !bytes.Equal(line, changePwNew) {
+			changePwStep = 1
+			changePwNew = nil
+			v.Title = "Passwords do not match, new password - [ESC] cancel"
+			return nil
+		}
+		err := ChangePassword(ViewDB, changePwOld, changePwNew)
+		if err != nil {
+			TheLog.Printf("change password failed: %s", err)
+			changePwStep = 0
+			changePwOld = nil
+			changePwNew = nil
+			v.Title = "Failed: " + err.Error() + " - current password / [ESC]"
+			return nil
+		}
+		Password = changePwNew
+		if err := Keys.Unlock(ViewDB, Password); err != nil {
+			TheLog.Printf("unlocking keys with the new password: %s", err)
+		}
+		changePwOld = nil
+		changePwNew = nil
+		v.Title = "Password changed - [ESC] close"
+		v.Editable = false
+		changePwStep = len(changePwTitles)
+		return nil
+	default:
+		return nil
+	}
+	changePwStep++
+	v.Title = changePwTitles[changePwStep]
+	return nil
+}
+
+func cancelChangePassword(g *gocui.Gui, v *gocui.View) error {
+	changePwOld = nil
+	changePwNew = nil
+	g.DeleteView("changepw")
+	g.SetCurrentView("v2")
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// the publish shown in the publishstatus view
+var publishStatusID string
+
+func publishStateIcon(state PublishState) string {
+	switch state {
+	case PublishAccepted:
+		return "✅"
+	case PublishRejected:
+		return "❌"
+	case PublishTimeout:
+		return "⏱"
+	}
+	return "⌛"
+}
+
+func refreshPublishStatus(g *gocui.Gui) error {
+	v, err := g.View("publishstatus")
+	if err != nil {
+		return nil
+	}
+	tp, results, found := Tracker.Results(publishStatusID)
+	v.Clear()
+	if !found {
+		fmt.Fprintf(v, "nothing published yet\n")
+		return nil
+	}
+	accepted := 0
+	for _, res := range results {
+		if res.State == PublishAccepted {
+			accepted++
+		}
+	}
+	fmt.Fprintf(v, "%s %s\naccepted by %d of %d relays\n\n", tp.Description, tp.Event.ID, accepted, len(results))
+	if len(results) == 0 {
+		fmt.Fprintf(v, "no relays connected\n")
+	}
+	for _, res := range results {
+		if res.Reason != "" {
+			fmt.Fprintf(v, "%s %s %s: %s\n", publishStateIcon(res.State), res.Relay, res.State, res.Reason)
+		} else {
+			fmt.Fprintf(v, "%s %s %s\n", publishStateIcon(res.State), res.Relay, res.State)
+		}
+	}
+	return nil
+}
+
+// show the per relay results for a publish, updated live
+func showPublishStatus(g *gocui.Gui, id string) error {
+	maxX, maxY := g.Size()
+	publishStatusID = id
+	if v, err := g.SetView("publishstatus", maxX/2-50, maxY/2-8, maxX/2+50, maxY/2+8, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Publish Status - [r]etry failed - [ESC]Dismiss"
+		v.Wrap = true
+		v.Editable = false
+		v.KeybindOnEdit = true
+	}
+	if _, err := g.SetCurrentView("publishstatus"); err != nil {
+		return err
+	}
+	return refreshPublishStatus(g)
+}
+
+// reopen the status of the last publish
+func lastPublishStatus(g *gocui.Gui, v *gocui.View) error {
+	return showPublishStatus(g, Tracker.Last())
+}
+
+func retryPublish(g *gocui.Gui, v *gocui.View) error {
+	go Tracker.Retry(publishStatusID)
+	return nil
+}
+
+func cancelPublishStatus(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("publishstatus")
+	g.SetCurrentView("v2")
+	return nil
+}
+
+// the pending events shown in the outbox view
+var outboxEntries []OutboxEvent
+
+func refreshOutbox(g *gocui.Gui) error {
+	v, err := g.View("outbox")
+	if err != nil {
+		return nil
+	}
+	outboxEntries = PendingOutbox(ViewDB)
+	v.Clear()
+	for _, o := range outboxEntries {
+		fmt.Fprintf(v, "%-40s accepted %d/%d, attempts %3d, since %s\n", o.Description, o.AcceptedCount, outboxMinAccepts, o.Attempts, o.CreatedAt.Format("Jan 02 15:04"))
+	}
+	if len(outboxEntries) == 0 {
+		fmt.Fprintf(v, "outbox is empty, everything was accepted\n")
+	}
+	return nil
+}
+
+// show signed events that are still waiting for relays to accept them
+func showOutbox(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("outbox", maxX/2-50, maxY/2-8, maxX/2+50, maxY/2+8, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Outbox - [r]etry all - [d]rop event - [Enter]status - [ESC]Dismiss"
+		v.Highlight = true
+		v.SelBgColor = gocui.ColorGreen
+		v.SelFgColor = gocui.ColorBlack
+		v.Editable = false
+		v.KeybindOnEdit = true
+		if _, err := g.SetCurrentView("outbox"); err != nil {
+			return err
+		}
+	}
+	return refreshOutbox(g)
+}
+
+func retryOutbox(g *gocui.Gui, v *gocui.View) error {
+	go func() {
+		RetryOutbox(ViewDB)
+		g.Update(refreshOutbox)
+	}()
+	return nil
+}
+
+func outboxSelected(v *gocui.View) (OutboxEvent, bool) {
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	if cy+oy >= len(outboxEntries) {
+		return OutboxEvent{}, false
+	}
+	return outboxEntries[cy+oy], true
+}
+
+func cursorDownOutbox(g *gocui.Gui, v *gocui.View) error {
+	return listCursorDown(v, len(outboxEntries))
+}
+
+func dropOutbox(g *gocui.Gui, v *gocui.View) error {
+	o, ok := outboxSelected(v)
+	if !ok {
+		return nil
+	}
+	if err := ViewDB.Delete(&o).Error; err != nil {
+		TheLog.Printf("error dropping outbox event: %s", err)
+	}
+	Bus.Publish(BusMessage{Topic: TopicOutbox})
+	return nil
+}
+
+func outboxPublishStatus(g *gocui.Gui, v *gocui.View) error {
+	o, ok := outboxSelected(v)
+	if !ok {
+		return nil
+	}
+	g.DeleteView("outbox")
+	return showPublishStatus(g, o.ID)
+}
+
+func cancelOutbox(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("outbox")
+	g.SetCurrentView("v2")
+	return nil
+}
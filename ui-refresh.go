@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/awesome-gocui/gocui"
 )
@@ -88,7 +89,10 @@ func refreshV3(g *gocui.Gui, v *gocui.View) error {
 func refreshRelays(g *gocui.Gui, v *gocui.View) error {
 	var RelayStatuses []RelayStatus
 	ViewDB.Find(&RelayStatuses)
-	v4, _ := g.View("v4")
+	v4, err := g.View("v4")
+	if err != nil {
+		return nil
+	}
 	v4.Clear()
 	for _, relayStatus := range RelayStatuses {
 		var shortStatus string
@@ -98,6 +102,14 @@ func refreshRelays(g *gocui.Gui, v *gocui.View) error {
 			shortStatus = "✅"
 		} else if relayStatus.Status == "waiting" {
 			shortStatus = "⌛"
+		} else if strings.HasPrefix(relayStatus.Status, "reconnecting") {
+			shortStatus = fmt.Sprintf("⌛%d", relayStatus.Retries)
+		} else if relayStatus.Status == "authenticated" {
+			shortStatus = "✅🔑"
+		} else if relayStatus.Status == "auth-required" {
+			shortStatus = "🔐"
+		} else if strings.HasPrefix(relayStatus.Status, "skipped") {
+			shortStatus = "🔒"
 		} else {
 			shortStatus = "❌"
 		}
@@ -108,7 +120,10 @@ func refreshRelays(g *gocui.Gui, v *gocui.View) error {
 }
 
 func refreshV5(g *gocui.Gui, v *gocui.View) error {
-	v5, _ := g.View("v5")
+	v5, err := g.View("v5")
+	if err != nil {
+		return nil
+	}
 	v5.Clear()
 	// HELP BUTTONS
 	NoticeColor := "\033[1;36m%s\033[0m"
@@ -117,15 +132,25 @@ func refreshV5(g *gocui.Gui, v *gocui.View) error {
 	f := fmt.Sprintf("(%s)efresh", fmt.Sprintf(NoticeColor, "r"))
 	t := fmt.Sprintf("(%s)next window", fmt.Sprintf(NoticeColor, "tab"))
 	a := fmt.Sprintf("(%s)dd relay", fmt.Sprintf(NoticeColor, "a"))
+	gl := fmt.Sprintf("(%s)et latest profile", fmt.Sprintf(NoticeColor, "g"))
+	lk := fmt.Sprintf("(%s)ock keys", fmt.Sprintf(NoticeColor, "L"))
 
-	fmt.Fprintf(v5, "%-30s%-30s%-30s%-30s%-30s\n", s, q, f, t, a)
+	fmt.Fprintf(v5, "%-30s%-30s%-30s%-30s%-30s%-30s%-30s\n", s, q, f, t, a, gl, lk)
 	ff := fmt.Sprintf("(%s)ollow", fmt.Sprintf(NoticeColor, "f"))
 	u := fmt.Sprintf("<soon>(%s)n-follow", fmt.Sprintf(NoticeColor, "u"))
 	m := fmt.Sprintf("<soon>(%s)ute", fmt.Sprintf(NoticeColor, "m"))
 	z := fmt.Sprintf("(%s)Select ALL", fmt.Sprintf(NoticeColor, "z"))
 	d := fmt.Sprintf("(%s)elete relay", fmt.Sprintf(NoticeColor, "d"))
 	c := fmt.Sprintf("(%s)onfigure keys", fmt.Sprintf(NoticeColor, "c"))
-	fmt.Fprintf(v5, "%-30s%-30s%-30s%-30s%-30s%-30s\n\n", ff, u, m, z, d, c)
+	i := fmt.Sprintf("(%s)nfo relay", fmt.Sprintf(NoticeColor, "i"))
+	l := fmt.Sprintf("relay (%s)ist", fmt.Sprintf(NoticeColor, "l"))
+	o := fmt.Sprintf("(%s)utbox fetch", fmt.Sprintf(NoticeColor, "o"))
+	p := fmt.Sprintf("(%s)ublish status", fmt.Sprintf(NoticeColor, "P"))
+	ob := fmt.Sprintf("(%s)utbox queue", fmt.Sprintf(NoticeColor, "O"))
+	ta := fmt.Sprintf("(%s)oggle relay auth", fmt.Sprintf(NoticeColor, "t"))
+	dr := fmt.Sprintf("(%s)iscover relays", fmt.Sprintf(NoticeColor, "D"))
+	fmt.Fprintf(v5, "%-30s%-30s%-30s%-30s%-30s%-30s%-30s\n", ff, u, m, z, c, p, ob)
+	fmt.Fprintf(v5, "relays: %-30s%-30s%-30s%-30s%-30s%-30s\n", d, i, l, o, ta, dr)
 
 	var ac Account
 	var mm Metadata
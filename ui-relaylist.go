@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// the active account's NIP-65 relay list, as displayed in the relaylist view
+var relayListEntries []RelayListEntry
+
+func relayListMarker(e RelayListEntry) string {
+	r := "-"
+	w := "-"
+	if e.Read {
+		r = "r"
+	}
+	if e.Write {
+		w = "w"
+	}
+	return "[" + r + w + "]"
+}
+
+func refreshRelayList(g *gocui.Gui) error {
+	v, err := g.View("relaylist")
+	if err != nil {
+		return nil
+	}
+	account := Account{}
+	if aerr := ViewDB.First(&account, "active = ?", true).Error; aerr != nil {
+		v.Clear()
+		fmt.Fprintf(v, "no account active\n")
+		return nil
+	}
+	relayListEntries = GetRelayList(ViewDB, account.Pubkey)
+	v.Clear()
+	for _, e := range relayListEntries {
+		fmt.Fprintf(v, "%s %s\n", relayListMarker(e), e.Url)
+	}
+	if len(relayListEntries) == 0 {
+		fmt.Fprintf(v, "no relay list published, [a]dd relays and [p]ublish\n")
+	}
+	return nil
+}
+
+// show and edit the active account's relay list
+func relayList(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("relaylist", maxX/2-50, maxY/2-10, maxX/2+50, maxY/2+10, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "My Relay List - [a]dd - [d]elete - toggle [r]ead/[w]rite - [p]ublish - [s]eed relays - [ESC]"
+		v.Highlight = true
+		v.SelBgColor = gocui.ColorGreen
+		v.SelFgColor = gocui.ColorBlack
+		v.Editable = false
+		v.KeybindOnEdit = true
+		if _, err := g.SetCurrentView("relaylist"); err != nil {
+			return err
+		}
+	}
+	return refreshRelayList(g)
+}
+
+func cancelRelayList(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("relaylist")
+	g.SetCurrentView("v4")
+	return nil
+}
+
+func relayListAdd(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("relaylistadd", maxX/2-30, maxY/2, maxX/2+30, maxY/2+2, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Add to Relay List? [enter] to save / [ESC] to cancel"
+		v.Editable = true
+		v.KeybindOnEdit = true
+		if _, err := g.SetCurrentView("relaylistadd"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func doRelayListAdd(g *gocui.Gui, v *gocui.View) error {
+	if v != nil {
+		line := strings.TrimSpace(v.Buffer())
+		g.DeleteView("relaylistadd")
+		g.SetCurrentView("relaylist")
+		if line == "" {
+			return nil
+		}
+		url, uerr := normalizeRelayURL(line)
+		if uerr != nil {
+			TheLog.Printf("not adding to relay list: %s", uerr)
+			return nil
+		}
+		account := Account{}
+		if aerr := ViewDB.First(&account, "active = ?", true).Error; aerr != nil {
+			TheLog.Printf("error getting active account: %s", aerr)
+			return nil
+		}
+		var existing int64
+		ViewDB.Model(&RelayListEntry{}).Where("pubkey_hex = ? and url = ?", account.Pubkey, url).Count(&existing)
+		if existing > 0 {
+			refreshRelayList(g)
+			return nil
+		}
+		err := ViewDB.Create(&RelayListEntry{PubkeyHex: account.Pubkey, Url: url, Read: true, Write: true}).Error
+		if err != nil {
+			TheLog.Printf("error adding to relay list: %s", err)
+		}
+		refreshRelayList(g)
+	}
+	return nil
+}
+
+func cancelRelayListAdd(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("relaylistadd")
+	g.SetCurrentView("relaylist")
+	return nil
+}
+
+func relayListSelected(v *gocui.View) (RelayListEntry, bool) {
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	if cy+oy >= len(relayListEntries) {
+		return RelayListEntry{}, false
+	}
+	return relayListEntries[cy+oy], true
+}
+
+func cursorDownRelayList(g *gocui.Gui, v *gocui.View) error {
+	return listCursorDown(v, len(relayListEntries))
+}
+
+func relayListDelete(g *gocui.Gui, v *gocui.View) error {
+	if e, ok := relayListSelected(v); ok {
+		if err := ViewDB.Delete(&e).Error; err != nil {
+			TheLog.Printf("error deleting from relay list: %s", err)
+		}
+		refreshRelayList(g)
+	}
+	return nil
+}
+
+func relayListToggleRead(g *gocui.Gui, v *gocui.View) error {
+	if e, ok := relayListSelected(v); ok {
+		// an entry must be at least one of read or write
+		if e.Read && !e.Write {
+			return nil
+		}
+		ViewDB.Model(&e).Update("read", !e.Read)
+		refreshRelayList(g)
+	}
+	return nil
+}
+
+func relayListToggleWrite(g *gocui.Gui, v *gocui.View) error {
+	if e, ok := relayListSelected(v); ok {
+		if e.Write && !e.Read {
+			return nil
+		}
+		ViewDB.Model(&e).Update("write", !e.Write)
+		refreshRelayList(g)
+	}
+	return nil
+}
+
+func relayListPublish(g *gocui.Gui, v *gocui.View) error {
+	account := Account{}
+	if aerr := ViewDB.First(&account, "active = ?", true).Error; aerr != nil {
+		TheLog.Printf("error getting active account: %s", aerr)
+		return nil
+	}
+	if account.WatchOnly {
+		g.DeleteView("relaylist")
+		return exportUnsigned(g, RelayListEvent(account.Pubkey, GetRelayList(ViewDB, account.Pubkey)))
+	}
+	if Keys.IsRemote(account.Pubkey) {
+		// the remote signer may wait for the user, don't block the UI on it
+		g.DeleteView("relaylist")
+		go func() {
+			id, err := PublishRelayList(ViewDB, account)
+			g.Update(func(g *gocui.Gui) error {
+				// replace the waiting message if it's still up
+				if mv, verr := g.View("error"); verr == nil && strings.HasPrefix(mv.Title, "Relay list") {
+					dismissError(g, mv)
+				}
+				if err != nil {
+					TheLog.Printf("error signing relay list: %s", err)
+					return showError(g, "Could not sign relay list", err)
+				}
+				return showPublishStatus(g, id)
+			})
+		}()
+		return showMessage(g, "Relay list", "sent to the remote signer, waiting for approval")
+	}
+	id, err := PublishRelayList(ViewDB, account)
+	if err != nil {
+		TheLog.Printf("error signing relay list: %s", err)
+		return showError(g, "Could not sign relay list", err)
+	}
+	g.DeleteView("relaylist")
+	return showPublishStatus(g, id)
+}
+
+func relayListSeed(g *gocui.Gui, v *gocui.View) error {
+	added := SeedRelayStatuses(ViewDB, relayListEntries)
+	v.Title = fmt.Sprintf("My Relay List - added %d relays", added)
+	refreshRelays(g, v)
+	return nil
+}
+
+// offer to seed the local relays from the active account's relay list
+func offerSeedRelays(g *gocui.Gui, entries []RelayListEntry) error {
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("seedrelays", maxX/2-50, maxY/2-3, maxX/2+50, maxY/2+3, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Seed Relays - (y)es - (n)o"
+		v.Editable = false
+		v.KeybindOnEdit = true
+		fmt.Fprintf(v, "found your published relay list with %d relays.\n", len(entries))
+		fmt.Fprintf(v, "add them to your local relays?\n")
+		relayListEntries = entries
+		if _, err := g.SetCurrentView("seedrelays"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func doSeedRelays(g *gocui.Gui, v *gocui.View) error {
+	SeedRelayStatuses(ViewDB, relayListEntries)
+	g.DeleteView("seedrelays")
+	g.SetCurrentView("v2")
+	refreshRelays(g, v)
+	return nil
+}
+
+func cancelSeedRelays(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("seedrelays")
+	g.SetCurrentView("v2")
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func addWatchOnly(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	g.DeleteView("config")
+	if v, err := g.SetView("watchonly", maxX/2-50, maxY/2-1, maxX/2+50, maxY/2+1, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Watch-only account (npub or hex pubkey) - [Enter]Save - [ESC]Cancel"
+		v.Editable = true
+		v.KeybindOnEdit = true
+		if _, err := g.SetCurrentView("watchonly"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func doAddWatchOnly(g *gocui.Gui, v *gocui.View) error {
+	if _, err := Keys.AddWatchOnly(ViewDB, v.Buffer()); err != nil {
+		v.Title = fmt.Sprintf("%s - [ESC]Cancel", err)
+		return nil
+	}
+	return cancelWatchOnly(g, v)
+}
+
+func cancelWatchOnly(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("watchonly")
+	g.SetCurrentView("v2")
+	return nil
+}
+
+// the active account can't sign, write the event out for signing elsewhere
+func exportUnsigned(g *gocui.Gui, ev nostr.Event) error {
+	name, err := ExportUnsignedEvent(ev)
+	if err != nil {
+		return showError(g, "Could not export unsigned event", err)
+	}
+	return showMessage(g, "Watch-only account", fmt.Sprintf("nothing was signed, the unsigned event was written to %s. sign it elsewhere and import it with [i] in the config view", name))
+}
+
+func importSigned(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	g.DeleteView("config")
+	if v, err := g.SetView("importsigned", maxX/2-50, maxY/2-2, maxX/2+50, maxY/2+2, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Import signed event (file name or one line of json) - [Enter]Publish - [ESC]Cancel"
+		v.Editable = true
+		v.Wrap = true
+		v.KeybindOnEdit = true
+		if _, err := g.SetCurrentView("importsigned"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func doImportSigned(g *gocui.Gui, v *gocui.View) error {
+	input := strings.TrimSpace(v.Buffer())
+	raw := []byte(input)
+	if input == "-" {
+		// stdin belongs to the terminal here
+		v.Title = "can't read stdin here, give a file name or paste the json - [ESC]Cancel"
+		return nil
+	}
+	if !strings.HasPrefix(input, "{") {
+		var err error
+		if raw, err = readSignedEvent(input); err != nil {
+			v.Title = fmt.Sprintf("%s - [ESC]Cancel", err)
+			return nil
+		}
+	}
+	ev, err := ImportSignedEvent(ViewDB, raw)
+	if err != nil {
+		v.Title = fmt.Sprintf("%s - [ESC]Cancel", err)
+		return nil
+	}
+	g.DeleteView("importsigned")
+	g.SetCurrentView("v2")
+	return showPublishStatus(g, ev.ID)
+}
+
+func cancelImportSigned(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("importsigned")
+	g.SetCurrentView("v2")
+	return nil
+}
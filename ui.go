@@ -1,16 +1,15 @@
 package main
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/awesome-gocui/gocui"
 	"github.com/nbd-wtf/go-nostr"
-	"github.com/nbd-wtf/go-nostr/nip19"
 )
 
 var selectableViews = []string{"v2", "v3", "v4"}
@@ -290,6 +289,17 @@ func displayMyMetadataShort() string {
 	ViewDB.Table("metadata_follows").Where("follow_pubkey_hex = ?", m.PubkeyHex).Count(&followersCount)
 	ViewDB.Table("metadata_follows").Where("metadata_pubkey_hex = ?", m.PubkeyHex).Count(&followsCount)
 	x := fmt.Sprintf(" | %s (Followers: %4d, Follows: %4d)", m.Name, followersCount, followsCount)
+	if account.WatchOnly {
+		x += " | watch-only"
+	}
+	if Keys.Locked() {
+		x += " | locked (L to unlock)"
+	}
+	var pending int64
+	ViewDB.Model(&OutboxEvent{}).Where("confirmed_at is null").Count(&pending)
+	if pending > 0 {
+		x += fmt.Sprintf(" | outbox: %d pending", pending)
+	}
 	return x
 }
 
@@ -324,7 +334,7 @@ func displayMetadataAsText(m Metadata) string {
 		m.Lud16,
 		m.About,
 	)
-	return x
+	return x + refetchStatus(m.PubkeyHex)
 }
 
 func addRelay(g *gocui.Gui, v *gocui.View) error {
@@ -359,16 +369,24 @@ func addRelay(g *gocui.Gui, v *gocui.View) error {
 
 func doAddRelay(g *gocui.Gui, v *gocui.View) error {
 	if v != nil {
-		line := v.Buffer()
+		line := strings.TrimSpace(v.Buffer())
 		if line == "" {
 			g.SetCurrentView("v2")
 			g.DeleteView("addrelay")
 			refreshRelays(g, v)
 			return nil
 		}
-		err := ViewDB.Create(&RelayStatus{Url: line, Status: "waiting"}).Error
+		url, uerr := normalizeRelayURL(line)
+		if uerr != nil {
+			TheLog.Printf("not adding relay: %s", uerr)
+			v.Title = fmt.Sprintf("%s - [ESC] to cancel", uerr)
+			return nil
+		}
+		err := ViewDB.Create(&RelayStatus{Url: url, Status: "waiting"}).Error
 		if err != nil {
 			TheLog.Println("error adding relay")
+		} else {
+			SendRelayCommand(RelayAdd, url)
 		}
 		g.DeleteView("addrelay")
 		refreshRelays(g, v)
@@ -382,17 +400,144 @@ func delRelay(g *gocui.Gui, v *gocui.View) error {
 		_, cy := v.Cursor()
 		var relayStatuses []RelayStatus
 		ViewDB.Find(&relayStatuses)
-		if len(relayStatuses) >= cy {
-			err := ViewDB.Model(&relayStatuses[cy]).Update("status", "deleting").Error
+		if cy < len(relayStatuses) {
+			SendRelayCommand(RelayRemove, relayStatuses[cy].Url)
+		}
+	}
+	return nil
+}
+
+func displayRelayInfoAsText(rs RelayStatus, info RelayInfo) string {
+	if info.FetchedAt.IsZero() {
+		return fmt.Sprintf("%s\nstatus: %s (retries: %d)\nallow auth: %t\n\nno relay information document (NIP-11) found\n", rs.Url, rs.Status, rs.Retries, rs.AllowAuth)
+	}
+	x := fmt.Sprintf("%s\nstatus: %s (retries: %d)\nallow auth: %t\n\nname: %s\ndescription: %s\nsoftware: %s %s\npubkey: %s\ncontact: %s\nsupported nips: %s\n\nlimitations:\nauth required: %t, payment required: %t\nmax filters: %d, max limit: %d, max subscriptions: %d\nmax message length: %d, max content length: %d, max event tags: %d\nmin pow difficulty: %d\n\nfetched: %s\n",
+		rs.Url,
+		rs.Status,
+		rs.Retries,
+		rs.AllowAuth,
+		info.Name,
+		info.Description,
+		info.Software,
+		info.Version,
+		info.Pubkey,
+		info.Contact,
+		info.SupportedNips,
+		info.AuthRequired,
+		info.PaymentRequired,
+		info.MaxFilters,
+		info.MaxLimit,
+		info.MaxSubscriptions,
+		info.MaxMessageLength,
+		info.MaxContentLength,
+		info.MaxEventTags,
+		info.MinPowDifficulty,
+		info.FetchedAt.Format(time.RFC1123),
+	)
+	return x
+}
+
+// show the NIP-11 info for the relay under the cursor
+func relayInfo(g *gocui.Gui, v *gocui.View) error {
+	if v == nil {
+		return nil
+	}
+	maxX, maxY := g.Size()
+	_, cy := v.Cursor()
+	var relayStatuses []RelayStatus
+	ViewDB.Find(&relayStatuses)
+	if cy >= len(relayStatuses) {
+		return nil
+	}
+	rs := relayStatuses[cy]
+	var info RelayInfo
+	ViewDB.First(&info, "url = ?", rs.Url)
+
+	if v, err := g.SetView("relayinfo", maxX/2-50, maxY/2-15, maxX/2+50, maxY/2+15, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Relay Details - [ESC]Dismiss - [u]pdate"
+		v.Wrap = true
+		v.Editable = false
+		v.KeybindOnEdit = true
+		fmt.Fprintf(v, "%s\n%s", displayRelayInfoAsText(rs, info), displayRelayMetricsAsText(ViewDB, rs.Url))
+		if _, err := g.SetCurrentView("relayinfo"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// re-fetch the NIP-11 document for the relay in the details view
+func updateRelayInfo(g *gocui.Gui, v *gocui.View) error {
+	v4, _ := g.View("v4")
+	_, cy := v4.Cursor()
+	var relayStatuses []RelayStatus
+	ViewDB.Find(&relayStatuses)
+	if cy >= len(relayStatuses) {
+		return nil
+	}
+	rs := relayStatuses[cy]
+	go func() {
+		doc, err := FetchRelayInfo(CTX, rs.Url)
+		if err != nil {
+			TheLog.Printf("failed fetching relay info for %s: %s", rs.Url, err)
+			return
+		}
+		info := UpdateOrCreateRelayInfo(ViewDB, rs.Url, doc)
+		g.Update(func(g *gocui.Gui) error {
+			v, err := g.View("relayinfo")
 			if err != nil {
-				//fmt.Println("error deleting relay")
-				//fmt.Println(err)
-			} else {
-				time.Sleep(1 * time.Second)
-				refreshRelays(g, v)
+				return nil
 			}
-		}
+			v.Clear()
+			fmt.Fprintf(v, "%s\n%s", displayRelayInfoAsText(rs, info), displayRelayMetricsAsText(ViewDB, rs.Url))
+			return nil
+		})
+	}()
+	return nil
+}
+
+func cancelRelayInfo(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("relayinfo")
+	g.SetCurrentView("v4")
+	return nil
+}
+
+// fetch profiles and follows from the relays our follows publish to
+func outboxFetch(g *gocui.Gui, v *gocui.View) error {
+	v4, _ := g.View("v4")
+	v4.Title = "Relays (outbox: planning)"
+	go func() {
+		planned, succeeded := RunOutboxFetch(ViewDB, CTX)
+		g.Update(func(g *gocui.Gui) error {
+			v4, _ := g.View("v4")
+			v4.Title = fmt.Sprintf("Relays (outbox: %d/%d)", succeeded, planned)
+			return nil
+		})
+	}()
+	return nil
+}
+
+// allow or deny NIP-42 auth for the relay under the cursor, and reconnect it
+func toggleRelayAuth(g *gocui.Gui, v *gocui.View) error {
+	if v == nil {
+		return nil
+	}
+	_, cy := v.Cursor()
+	var relayStatuses []RelayStatus
+	ViewDB.Find(&relayStatuses)
+	if cy >= len(relayStatuses) {
+		return nil
+	}
+	rs := relayStatuses[cy]
+	err := ViewDB.Model(&rs).Update("allow_auth", !rs.AllowAuth).Error
+	if err != nil {
+		TheLog.Printf("error toggling auth for %s: %s", rs.Url, err)
+		return nil
 	}
+	SendRelayCommand(RelayReconnect, rs.Url)
 	return nil
 }
 
@@ -414,25 +559,25 @@ func config(g *gocui.Gui, v *gocui.View) error {
 			return err
 		}
 
-		theKey := ""
 		for _, acct := range accounts {
 			var m Metadata
 			ViewDB.First(&m, "pubkey_hex = ?", acct.Pubkey)
-			theKey = Decrypt(string(Password), acct.Privatekey)
-			if len(theKey) != 64 {
-				fmt.Fprintf(v, "invalid key.. delete please: %s", theKey)
+			activeNotice := ""
+			if acct.Active {
+				activeNotice = "*"
+			}
+			if acct.WatchOnly {
+				fmt.Fprintf(v, "%s[watch-only] for %s %s\n", activeNotice, m.Name, acct.PubkeyNpub)
+			} else if acct.Bunker != "" && Keys.Status(acct.Pubkey) == nil {
+				fmt.Fprintf(v, "%s[remote signer] for %s %s\n", activeNotice, m.Name, acct.PubkeyNpub)
+			} else if kerr := Keys.Status(acct.Pubkey); kerr != nil {
+				fmt.Fprintf(v, "%s[unusable key: %s] for %s %s\n", activeNotice, kerr, m.Name, acct.PubkeyNpub)
 			} else {
-				activeNotice := ""
-				if acct.Active {
-					activeNotice = "*"
-				}
-				fmt.Fprintf(v, "%s[%s ... ] for %s %s\n", activeNotice, theKey[0:5], m.Name, acct.PubkeyNpub)
-				// full priv key printing
-				//fmt.Fprintf(v, "[%s] for %s\n", theKey, acct.Pubkey)
+				fmt.Fprintf(v, "%s[key ok] for %s %s\n", activeNotice, m.Name, acct.PubkeyNpub)
 			}
 		}
 
-		v.Title = "Config Private Keys - [Enter]Use key - [ESC]Cancel - [n]ew key - [d]elete key - [g]enerate key"
+		v.Title = "Config Private Keys - [Enter]Use key - [ESC]Cancel - [n]ew key - [d]elete key - [g]enerate key - seed [m]nemonic - [r]estore - e[x]port - watch-[o]nly - [i]mport signed - remote signer [b]unker - change pass[w]ord"
 		v.Highlight = true
 		v.SelBgColor = gocui.ColorGreen
 		v.SelFgColor = gocui.ColorBlack
@@ -457,7 +602,7 @@ func configNew(
 			return err
 		}
 
-		v.Title = "New/Edit Private Key - [Enter]Save - [ESC]Cancel -"
+		v.Title = "New Private Key (hex, nsec or ncryptsec) - [Enter]Save - [ESC]Cancel -"
 		v.Highlight = true
 		v.SelBgColor = gocui.ColorGreen
 		v.SelFgColor = gocui.ColorBlack
@@ -481,15 +626,11 @@ func activateConfig(
 	if aerr != nil {
 		TheLog.Printf("error getting accounts: %s", aerr)
 	}
-	for i, acct := range accounts {
-		if i != cy {
-			acct.Active = false
-			ViewDB.Save(&acct)
+	if cy < len(accounts) {
+		if err := UseAccount(ViewDB, accounts[cy].Pubkey); err != nil {
+			TheLog.Printf("error activating account: %s", err)
 		}
 	}
-
-	accounts[cy].Active = true
-	ViewDB.Save(accounts[cy])
 	g.DeleteView("config")
 	refreshV5(g, v)
 	g.SetCurrentView("v2")
@@ -498,22 +639,14 @@ func activateConfig(
 
 func generateConfig(g *gocui.Gui, v *gocui.View) error {
 	if v != nil {
-		sk := nostr.GeneratePrivateKey()
-		encKey := Encrypt(string(Password), sk)
-		pk, ep := nostr.GetPublicKey(sk)
-		npub, ep2 := nip19.EncodePublicKey(pk)
-		if ep != nil || ep2 != nil {
-			TheLog.Printf("error getting public key: %s", ep)
-		}
-		account := Account{Privatekey: encKey, Pubkey: pk, PubkeyNpub: npub, Active: true}
-		e2 := ViewDB.Save(&account).Error
-		if e2 != nil {
-			TheLog.Printf("error saving private key: %s", e2)
-		}
-
+		_, err := Keys.Add(ViewDB, nostr.GeneratePrivateKey())
 		g.SetCurrentView("v2")
 		g.DeleteView("config")
 		refreshV5(g, v)
+		if err != nil {
+			TheLog.Printf("error saving private key: %s", err)
+			return showError(g, "Could not save the new key", err)
+		}
 	}
 	return nil
 }
@@ -530,8 +663,15 @@ func configShowPrivateKey(
 	if aerr != nil {
 		TheLog.Printf("error getting accounts: %s", aerr)
 	}
-	sk := Decrypt(string(Password), accounts[cy].Privatekey)
+	if cy >= len(accounts) {
+		return nil
+	}
+	sk, kerr := Keys.Reveal(accounts[cy].Pubkey)
 	g.DeleteView("config")
+	if kerr != nil {
+		g.SetCurrentView("v2")
+		return showError(g, "Could not show private key", kerr)
+	}
 	if v, err := g.SetView("configshow", maxX/2-50, maxY/2-1, maxX/2+50, maxY/2+1, 0); err != nil {
 		if !errors.Is(err, gocui.ErrUnknownView) {
 			return err
@@ -553,25 +693,31 @@ func configShowPrivateKey(
 
 func doConfigNew(g *gocui.Gui, v *gocui.View) error {
 	if v != nil {
-		line := v.Buffer()
+		line := strings.TrimSpace(v.Buffer())
 		if line == "" {
 			TheLog.Println("no private key entered")
 			g.SetCurrentView("v2")
 			g.DeleteView("confignew")
 			return nil
 		}
-		//fmt.Println(line)
-		//fmt.Println("saving config")
-		encKey := Encrypt(string(Password), line)
-		pk, ep := nostr.GetPublicKey(line)
-		npub, ep2 := nip19.EncodePublicKey(pk)
-		if ep != nil || ep2 != nil {
-			TheLog.Printf("error getting public key: %s", ep)
+		format, ferr := DetectKeyFormat(line)
+		if ferr != nil {
+			v.Title = fmt.Sprintf("%s - [ESC]Cancel", ferr)
+			return nil
+		}
+		if format == KeyFormatNcryptsec {
+			return askImportPassword(g, line)
 		}
-		account := Account{Privatekey: encKey, Pubkey: pk, PubkeyNpub: npub, Active: true}
-		e2 := ViewDB.Save(&account).Error
-		if e2 != nil {
-			TheLog.Printf("error saving private key: %s", e2)
+		sk, _, perr := ParsePrivateKey(line, "")
+		if perr != nil {
+			v.Title = fmt.Sprintf("%s - [ESC]Cancel", perr)
+			return nil
+		}
+		_, err := Keys.Add(ViewDB, sk)
+		if err != nil {
+			TheLog.Printf("error saving private key: %s", err)
+			v.Title = fmt.Sprintf("%s - [ESC]Cancel", err)
+			return nil
 		}
 
 		g.SetCurrentView("v2")
@@ -605,6 +751,8 @@ func doConfigDel(g *gocui.Gui, v *gocui.View) error {
 		e2 := ViewDB.Delete(&accounts[cy]).Error
 		if e2 != nil {
 			TheLog.Printf("error deleting private key: %s", e2)
+		} else {
+			Keys.Forget(accounts[cy].Pubkey)
 		}
 
 		// activate a different account if there are any
@@ -620,6 +768,7 @@ func doConfigDel(g *gocui.Gui, v *gocui.View) error {
 			accounts[0].Active = true
 			ViewDB.Save(&accounts[0])
 		}
+		Bus.Publish(BusMessage{Topic: TopicAccount})
 
 		refreshV5(g, v)
 
@@ -665,6 +814,41 @@ func cursorUpConfig(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
+// move the cursor down a list of n lines, scrolling the origin once the
+// cursor reaches the bottom of the view and stopping at the last line
+func listCursorDown(v *gocui.View, n int) error {
+	if v == nil {
+		return nil
+	}
+	_, cy := v.Cursor()
+	ox, oy := v.Origin()
+	_, sy := v.Size()
+	// end of list
+	if oy+cy+1 >= n {
+		return nil
+	}
+	if cy < sy-1 {
+		return v.SetCursor(0, cy+1)
+	}
+	return v.SetOrigin(ox, oy+1)
+}
+
+// move the cursor up a list, scrolling the origin back at the top of the view
+func listCursorUp(g *gocui.Gui, v *gocui.View) error {
+	if v == nil {
+		return nil
+	}
+	_, cy := v.Cursor()
+	ox, oy := v.Origin()
+	if cy > 0 {
+		return v.SetCursor(0, cy-1)
+	}
+	if oy > 0 {
+		return v.SetOrigin(ox, oy-1)
+	}
+	return nil
+}
+
 func cancelConfigNew(g *gocui.Gui, v *gocui.View) error {
 	g.DeleteView("confignew")
 	g.SetCurrentView("v2")
@@ -727,6 +911,11 @@ func follow(g *gocui.Gui, v *gocui.View) error {
 			return err
 		}
 		v.Title = "Follow - (y)es - (n)o - (esc) cancel"
+		if account.WatchOnly {
+			v.Title = "Follow (watch-only) - (y)es exports unsigned event JSON - (n)o - (esc) cancel"
+		} else if Keys.IsRemote(account.Pubkey) {
+			v.Title = "Follow (remote signer) - (y)es asks the signer for approval - (n)o - (esc) cancel"
+		}
 		v.Highlight = true
 		v.SelBgColor = gocui.ColorGreen
 		v.SelFgColor = gocui.ColorBlack
@@ -802,6 +991,10 @@ func sanitizeHighlighted(h []string) []string {
 }
 
 func doFollow(g *gocui.Gui, v *gocui.View) error {
+	// already waiting on the remote signer
+	if followCancel != nil {
+		return nil
+	}
 	cView, _ := g.View("v2")
 	_, cy := cView.Cursor()
 
@@ -819,64 +1012,44 @@ func doFollow(g *gocui.Gui, v *gocui.View) error {
 		return nil
 	}
 
-	// get list of current follows
-	var me Metadata
-	err := ViewDB.First(&me, "pubkey_hex = ?", account.Pubkey).Error
-	if err != nil {
-		TheLog.Printf("error getting metadata for account pubkey: %s", err)
-	}
-	var curFollows []Metadata
-	assocError := ViewDB.Model(&me).Association("Follows").Find(&curFollows)
-	if assocError != nil {
-		TheLog.Printf("error getting follows for account: %s", assocError)
-	}
-
-	var tags nostr.Tags
+	// current follows plus the new ones
 	// todo: set the relay nicely!
-	for _, follow := range curFollows {
-		tag := nostr.Tag{"p", follow.PubkeyHex}
-		tags = append(tags, tag)
-	}
-
-	newtag := nostr.Tag{"p", m.PubkeyHex}
-	tags = append(tags, newtag)
+	add := append([]string{m.PubkeyHex}, sanitizeHighlighted(highlighted)...)
+	ev := ContactListEvent(ViewDB, account.Pubkey, add)
 
-	s := sanitizeHighlighted(highlighted)
-	for _, hi := range s {
-		newtag := nostr.Tag{"p", hi}
-		tags = append(tags, newtag)
+	if account.WatchOnly {
+		highlighted = []string{}
+		g.DeleteView("follow")
+		g.SetCurrentView("v2")
+		return exportUnsigned(g, ev)
 	}
 
-	ev := nostr.Event{
-		PubKey:    account.Pubkey,
-		CreatedAt: time.Now(),
-		Kind:      nostr.KindContactList,
-		Tags:      tags,
-		Content:   "",
+	description := offlineDescription(ev)
+	if Keys.IsRemote(account.Pubkey) {
+		return signFollowRemotely(g, ev, description)
 	}
 
 	// calling Sign sets the event ID field and the event Sig field
-	ev.Sign(Decrypt(string(Password), account.Privatekey))
-	// create context with deadline and cancel
-	go func() {
-		ctx, cancel := context.WithTimeout(CTX, 10*time.Second)
-		defer cancel()
-		for _, r := range nostrRelays {
-			TheLog.Printf("publishing contact list (%d follows) to %s\n", len(tags), r.URL)
-			result := r.Publish(CTX, ev)
-			TheLog.Println(result)
-			TheLog.Printf("published to %s %v", r.URL, r.Publish(ctx, ev))
-		}
-	}()
+	if err := Keys.Sign(account.Pubkey, &ev); err != nil {
+		TheLog.Printf("error signing contact list: %s", err)
+		g.DeleteView("follow")
+		g.SetCurrentView("v2")
+		return showError(g, "Could not sign contact list", err)
+	}
+	id := QueueEvent(ViewDB, ev, description)
 
 	highlighted = []string{}
 	g.SetCurrentView("v2")
 	g.DeleteView("follow")
 
-	return nil
+	return showPublishStatus(g, id)
 }
 
 func cancelFollow(g *gocui.Gui, v *gocui.View) error {
+	if followCancel != nil {
+		followCancel()
+		followCancel = nil
+	}
 	g.SetCurrentView("v2")
 	g.DeleteView("follow")
 	return nil
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// parse an npub or hex pubkey
+func ParsePubkey(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "npub1") {
+		prefix, value, err := nip19.Decode(s)
+		if err != nil || prefix != "npub" {
+			return "", errors.New("invalid npub")
+		}
+		s = value.(string)
+	}
+	s = strings.ToLower(s)
+	if len(s) != 64 || !isHex(s) {
+		return "", errors.New("pubkey must be an npub or 64 hex characters")
+	}
+	return s, nil
+}
+
+// ExportUnsignedEvent writes an event that can't be signed here to a json
+// file, for signing elsewhere.  Returns the file name.
+func ExportUnsignedEvent(ev nostr.Event) (string, error) {
+	ev.ID = ev.GetID()
+	ev.Sig = ""
+	raw, err := json.MarshalIndent(ev, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("unsigned-%d-%s.json", ev.Kind, ev.ID[:12])
+	if err := os.WriteFile(name, raw, 0600); err != nil {
+		return "", err
+	}
+	return name, nil
+}